@@ -0,0 +1,163 @@
+package huffman
+
+import "fmt"
+
+// Batch holds the output of CompressBatch or DecompressBatch: every item back
+// to back in one arena, delimited by Offsets. Reusing a Batch across calls
+// reuses its arena, so a steady stream of similar batches allocates nothing.
+type Batch struct {
+	// Arena holds the output of every item back to back.
+	Arena []byte
+	// Offsets has one entry more than there are items, item i is
+	// Arena[Offsets[i]:Offsets[i+1]]. A failed item is empty.
+	Offsets []int
+	// Errs is nil when every item succeeded. Otherwise it has one entry per
+	// item, nil for the items that succeeded.
+	Errs []error
+}
+
+// Len returns the number of items in b.
+func (b *Batch) Len() int {
+	if len(b.Offsets) == 0 {
+		return 0
+	}
+	return len(b.Offsets) - 1
+}
+
+// Item returns the output of item i. It aliases b.Arena and is only valid
+// until b is reused.
+func (b *Batch) Item(i int) []byte {
+	return b.Arena[b.Offsets[i]:b.Offsets[i+1]:b.Offsets[i+1]]
+}
+
+// Err returns the error of item i, nil if it succeeded.
+func (b *Batch) Err(i int) error {
+	if b.Errs == nil {
+		return nil
+	}
+	return b.Errs[i]
+}
+
+// reset prepares b for n items, keeping its storage.
+func (b *Batch) reset(n int) {
+	b.Arena = b.Arena[:0]
+	if cap(b.Offsets) < n+1 {
+		b.Offsets = make([]int, 0, n+1)
+	}
+	b.Offsets = append(b.Offsets[:0], 0)
+	b.Errs = nil
+}
+
+// fail records err for item i of n.
+func (b *Batch) fail(i, n int, err error) {
+	if b.Errs == nil {
+		b.Errs = make([]error, n)
+	}
+	b.Errs[i] = fmt.Errorf("item %d: %w", i, err)
+}
+
+// firstErr is the error a batch call returns: nil, or the first item's error.
+func (b *Batch) firstErr() error {
+	for _, err := range b.Errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CompressBatch compresses every payload into b, reusing b's storage. The
+// arena is sized for the worst case of all payloads together, so it is
+// allocated at most once per batch, and not at all once b has grown to the
+// size of the batches it sees.
+//
+// Items fail individually: the returned error is that of the first failed
+// item, b.Err reports each of them.
+func (huff *Huffman) CompressBatch(b *Batch, payloads [][]byte) error {
+	d, err := huff.dictionary(ErrHuffmanCompress)
+	if err != nil {
+		return err
+	}
+	b.reset(len(payloads))
+
+	var total uint64
+	for i, p := range payloads {
+		size, ok := compressBufSize(len(p), d.maxCodeLen, maxAlloc)
+		if !ok || size > maxAlloc-total {
+			b.fail(i, len(payloads), fmt.Errorf("%w: input of %d bytes needs more than %d bytes of output buffer", ErrHuffmanCompress, len(p), uint64(maxAlloc)))
+			continue
+		}
+		total += size
+	}
+	if cap(b.Arena) < int(total) {
+		b.Arena = make([]byte, 0, int(total))
+	}
+
+	arena := b.Arena[:total]
+	pos := 0
+	for i, p := range payloads {
+		if b.Err(i) == nil {
+			n, _ := d.encode(arena[pos:], p, huff.LegacyPadding, noLimit)
+			if err := huff.checkEncoded(n); err != nil {
+				b.fail(i, len(payloads), err)
+			} else {
+				pos += n
+			}
+		}
+		b.Offsets = append(b.Offsets, pos)
+	}
+	b.Arena = arena[:pos]
+	return b.firstErr()
+}
+
+// DecompressBatch decompresses every payload into b, reusing b's storage. The
+// arena is sized for the worst case of all payloads together, so it is
+// allocated at most once per batch, and not at all once b has grown to the
+// size of the batches it sees. That worst case is one symbol per input bit,
+// 8 bytes per input byte, unless OutputLimit is set: then each item reserves
+// only the limit, or its input size if larger. A stream that exceeds the
+// limit may cost an allocation of its own before it is rejected.
+//
+// Items fail individually: the returned error is that of the first failed
+// item, b.Err reports each of them. Strict applies to every item.
+func (huff *Huffman) DecompressBatch(b *Batch, payloads [][]byte) error {
+	if _, err := huff.dictionary(ErrHuffmanDecompress); err != nil {
+		return err
+	}
+	b.reset(len(payloads))
+
+	var total uint64
+	for i, p := range payloads {
+		size, ok := decompressBufSize(len(p), maxAlloc)
+		if huff.OutputLimit > 0 {
+			// DecompressTo grows an arena with less room than the input
+			limited := max(uint64(huff.OutputLimit), uint64(len(p)))
+			if !ok || limited < size {
+				size, ok = limited, limited <= maxAlloc
+			}
+		}
+		if !ok || size > maxAlloc-total {
+			b.fail(i, len(payloads), fmt.Errorf("%w: input of %d bytes may decode to more than %d bytes", ErrHuffmanDecompress, len(p), uint64(maxAlloc)))
+			continue
+		}
+		total += size
+	}
+	if uint64(cap(b.Arena)) < total {
+		b.Arena = make([]byte, 0, int(total))
+	}
+
+	arena := b.Arena
+	for i, p := range payloads {
+		if b.Err(i) == nil {
+			out, err := huff.DecompressTo(arena, p)
+			if err != nil {
+				b.fail(i, len(payloads), err)
+			} else {
+				arena = out
+			}
+		}
+		b.Offsets = append(b.Offsets, len(arena))
+	}
+	b.Arena = arena
+	return b.firstErr()
+}
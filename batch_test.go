@@ -0,0 +1,212 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func batchPayloads() [][]byte {
+	var payloads [][]byte
+	for _, e := range regressionCorpus() {
+		payloads = append(payloads, e.data)
+	}
+	for seed := int64(0); seed < 16; seed++ {
+		payloads = append(payloads, snapshotLike(seed, 200+int(seed)*50))
+	}
+	return payloads
+}
+
+// TestBatchMatchesSingleCalls: every batch item must be exactly what the
+// corresponding single call produces.
+func TestBatchMatchesSingleCalls(t *testing.T) {
+	huff := NewHuffman()
+	payloads := batchPayloads()
+
+	var compressed Batch
+	if err := huff.CompressBatch(&compressed, payloads); err != nil {
+		t.Fatal(err)
+	}
+	if compressed.Len() != len(payloads) {
+		t.Fatalf("Len = %d, want %d", compressed.Len(), len(payloads))
+	}
+	items := make([][]byte, compressed.Len())
+	for i, p := range payloads {
+		want, err := huff.Compress(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := compressed.Item(i); !bytes.Equal(got, want) {
+			t.Fatalf("item %d: CompressBatch = %x, want %x", i, got, want)
+		}
+		items[i] = compressed.Item(i)
+	}
+
+	var decompressed Batch
+	if err := huff.DecompressBatch(&decompressed, items); err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range payloads {
+		if got := decompressed.Item(i); !bytes.Equal(got, p) {
+			t.Fatalf("item %d: DecompressBatch returned %d bytes, want %d", i, len(got), len(p))
+		}
+	}
+}
+
+func TestDecompressBatchItemErrors(t *testing.T) {
+	huff := NewHuffman()
+	good, err := huff.Compress([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := good[:len(good)/2]
+
+	var b Batch
+	err = huff.DecompressBatch(&b, [][]byte{good, truncated, good, nil})
+	if !errors.Is(err, ErrHuffmanDecompress) {
+		t.Fatalf("DecompressBatch error = %v, want the item's ErrHuffmanDecompress", err)
+	}
+	for i, want := range []string{"hello world", "", "hello world", ""} {
+		if got := string(b.Item(i)); got != want {
+			t.Errorf("item %d = %q, want %q", i, got, want)
+		}
+		if (b.Err(i) != nil) != (i == 1) {
+			t.Errorf("item %d: Err = %v", i, b.Err(i))
+		}
+	}
+
+	// reusing the batch must clear the previous errors
+	if err := huff.DecompressBatch(&b, [][]byte{good}); err != nil || b.Errs != nil {
+		t.Fatalf("reused batch: err = %v, Errs = %v", err, b.Errs)
+	}
+}
+
+func TestBatchAllocations(t *testing.T) {
+	huff := NewHuffman()
+	payloads := batchPayloads()
+	var compressed, decompressed Batch
+
+	allocs := testing.AllocsPerRun(1, func() {
+		var b Batch
+		if err := huff.CompressBatch(&b, payloads); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// one arena plus the offsets
+	if allocs > 2 {
+		t.Errorf("fresh CompressBatch allocated %.0f times", allocs)
+	}
+
+	if err := huff.CompressBatch(&compressed, payloads); err != nil {
+		t.Fatal(err)
+	}
+	items := make([][]byte, compressed.Len())
+	for i := range items {
+		items[i] = compressed.Item(i)
+	}
+	if err := huff.DecompressBatch(&decompressed, items); err != nil {
+		t.Fatal(err)
+	}
+
+	allocs = testing.AllocsPerRun(10, func() {
+		if err := huff.CompressBatch(&compressed, payloads); err != nil {
+			t.Fatal(err)
+		}
+		if err := huff.DecompressBatch(&decompressed, items); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("reused batches allocated %.0f times", allocs)
+	}
+}
+
+// TestDecompressBatchLarge: a batch far beyond what a single DecompressTo
+// sizes for outright still gets its arena in one allocation.
+func TestDecompressBatchLarge(t *testing.T) {
+	huff := NewHuffman()
+	var payloads [][]byte
+	for seed := int64(0); seed < 64; seed++ {
+		payloads = append(payloads, snapshotLike(seed, 16<<10))
+	}
+	var compressed Batch
+	if err := huff.CompressBatch(&compressed, payloads); err != nil {
+		t.Fatal(err)
+	}
+	items := make([][]byte, compressed.Len())
+	for i := range items {
+		items[i] = compressed.Item(i)
+	}
+	if len(compressed.Arena) <= 128<<10 {
+		t.Fatalf("batch of %d compressed bytes is too small for the test", len(compressed.Arena))
+	}
+
+	allocs := testing.AllocsPerRun(1, func() {
+		var b Batch
+		if err := huff.DecompressBatch(&b, items); err != nil {
+			t.Fatal(err)
+		}
+		for i, p := range payloads {
+			if !bytes.Equal(b.Item(i), p) {
+				t.Fatalf("item %d differs", i)
+			}
+		}
+	})
+	// one arena plus the offsets
+	if allocs > 2 {
+		t.Errorf("fresh DecompressBatch allocated %.0f times", allocs)
+	}
+}
+
+func TestDecompressBatchOutputLimit(t *testing.T) {
+	const limit = 1400
+	huff := NewHuffman(WithOutputLimit(limit))
+	var payloads [][]byte
+	for seed := int64(0); seed < 1000; seed++ {
+		payloads = append(payloads, snapshotLike(seed, 1024))
+	}
+	var compressed Batch
+	if err := huff.CompressBatch(&compressed, payloads); err != nil {
+		t.Fatal(err)
+	}
+	items := make([][]byte, compressed.Len())
+	for i := range items {
+		items[i] = compressed.Item(i)
+		if 8*len(items[i])+8 <= limit {
+			t.Fatalf("item %d of %d bytes is too small for the test", i, len(items[i]))
+		}
+	}
+
+	allocs := testing.AllocsPerRun(1, func() {
+		var b Batch
+		if err := huff.DecompressBatch(&b, items); err != nil {
+			t.Fatal(err)
+		}
+		for i, p := range payloads {
+			if !bytes.Equal(b.Item(i), p) {
+				t.Fatalf("item %d differs", i)
+			}
+		}
+		// the limit per item, not 8 bytes per input byte
+		if cap(b.Arena) != limit*len(items) {
+			t.Fatalf("arena of %d bytes, want %d", cap(b.Arena), limit*len(items))
+		}
+	})
+	if allocs > 2 {
+		t.Errorf("fresh DecompressBatch allocated %.0f times", allocs)
+	}
+
+	// an item over the limit fails on its own
+	over, err := Compress(snapshotLike(1, limit+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items[1] = over
+	var b Batch
+	if err := huff.DecompressBatch(&b, items); !errors.Is(err, ErrOutputLimit) || b.Err(0) != nil || b.Err(1) == nil || b.Err(2) != nil {
+		t.Fatalf("DecompressBatch with an item over the limit: %v", err)
+	}
+	if !bytes.Equal(b.Item(2), payloads[2]) {
+		t.Fatal("item after the one over the limit differs")
+	}
+}
@@ -135,6 +135,27 @@ func BenchmarkDecompressToReuse(b *testing.B) {
 	}
 }
 
+// BenchmarkCompressIfSmaller is the packet builder's view of Compress. The
+// random entries are where it should beat Compress by giving up early.
+func BenchmarkCompressIfSmaller(b *testing.B) {
+	huff := NewHuffman()
+	for _, e := range benchCorpus {
+		b.Run(e.name, func(b *testing.B) {
+			buf := make([]byte, 0, len(e.data)+64)
+			b.SetBytes(int64(len(e.data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				out, _, err := huff.CompressIfSmaller(buf[:0], e.data)
+				if err != nil {
+					b.Fatal(err)
+				}
+				sinkBytes = out
+			}
+		})
+	}
+}
+
 // BenchmarkRoundtrip measures the full encode+decode path on a typical
 // teeworlds-sized packet, which is the dominant real-world workload.
 func BenchmarkRoundtrip(b *testing.B) {
@@ -170,3 +191,58 @@ var (
 	sinkInt   int
 	sinkDict  *Dictionary
 )
+
+// BenchmarkSymbols ranges over the lazy decoder without collecting its
+// output, the way a parser reading ints off the stream would.
+func BenchmarkSymbols(b *testing.B) {
+	huff := NewHuffman()
+	for _, e := range benchCorpus {
+		compressed, err := huff.Compress(e.data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(e.name, func(b *testing.B) {
+			b.SetBytes(int64(len(e.data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				n := 0
+				for c, err := range huff.Symbols(compressed) {
+					if err != nil {
+						b.Fatal(err)
+					}
+					n += int(c)
+				}
+				sinkInt = n
+			}
+		})
+	}
+}
+
+// BenchmarkReaderWriteTo is io.Copy out of a reused Reader, which goes
+// through WriteTo and its retained buffer.
+func BenchmarkReaderWriteTo(b *testing.B) {
+	huff := NewHuffman()
+	for _, e := range benchCorpus {
+		compressed, err := huff.Compress(e.data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(e.name, func(b *testing.B) {
+			src := bytes.NewReader(compressed)
+			r := NewReader(src)
+			b.SetBytes(int64(len(e.data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				src.Reset(compressed)
+				r.Reset(src)
+				n, err := io.Copy(io.Discard, r)
+				if err != nil {
+					b.Fatal(err)
+				}
+				sinkInt = int(n)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// maxBitField is the widest raw field WriteBits and ReadBits take at once.
+const maxBitField = 32
+
+// BitWriter writes Huffman symbols of a Dictionary and raw bit fields into one
+// LSB-first bit stream, the bit order of every teeworlds Huffman stream. It is
+// meant for formats that mix the two; plain payloads are better served by
+// Compress and Writer, which are considerably faster.
+//
+// Nothing is implied about the end of the stream: a decoder only stops at an
+// EOF symbol if one is written with WriteSymbol(EofSymbol).
+type BitWriter struct {
+	d        *Dictionary
+	buf      []byte
+	acc      uint64 // pending bits, LSB first
+	bitCount uint   // number of pending bits, always below 32
+	written  int64
+}
+
+// NewBitWriter creates a BitWriter encoding with d that appends to dst.
+func NewBitWriter(d *Dictionary, dst []byte) *BitWriter {
+	return &BitWriter{d: d, buf: dst}
+}
+
+// Reset discards the state of w and makes it append to dst.
+func (w *BitWriter) Reset(dst []byte) {
+	*w = BitWriter{d: w.d, buf: dst}
+}
+
+// WriteSymbol writes the code of sym, a byte value or EofSymbol.
+func (w *BitWriter) WriteSymbol(sym int) error {
+	d := w.d
+	if err := d.usable(ErrHuffmanCompress); err != nil {
+		return err
+	}
+	if sym < 0 || sym > EofSymbol {
+		return fmt.Errorf("%w: symbol %d out of range", ErrHuffmanCompress, sym)
+	}
+	w.put(d.encBits[sym], uint(d.encLen[sym]))
+	return nil
+}
+
+// WriteBits writes the low n bits of v, least significant bit first. n must
+// not exceed 32.
+func (w *BitWriter) WriteBits(v uint32, n uint) error {
+	if n > maxBitField {
+		return fmt.Errorf("%w: cannot write %d bits at once, maximum is %d", ErrHuffmanCompress, n, maxBitField)
+	}
+	w.put(v&uint32(uint64(1)<<n-1), n)
+	return nil
+}
+
+func (w *BitWriter) put(v uint32, n uint) {
+	w.acc |= uint64(v) << w.bitCount
+	w.bitCount += n
+	w.written += int64(n)
+	if w.bitCount >= 32 {
+		w.buf = binary.LittleEndian.AppendUint32(w.buf, uint32(w.acc))
+		w.acc >>= 32
+		w.bitCount -= 32
+	}
+}
+
+// BitsWritten returns the number of bits written since w was created or reset.
+func (w *BitWriter) BitsWritten() int64 {
+	return w.written
+}
+
+// Bytes returns dst with the stream written so far appended, its last byte
+// padded with zero bits. Writing may continue afterwards; the returned slice
+// shares storage with w and is only valid until the next write.
+func (w *BitWriter) Bytes() []byte {
+	out := w.buf
+	acc := w.acc
+	for n := int(w.bitCount); n > 0; n -= 8 {
+		out = append(out, byte(acc))
+		acc >>= 8
+	}
+	return out
+}
+
+// BitReader reads Huffman symbols of a Dictionary and raw bit fields from an
+// LSB-first bit stream, the counterpart of BitWriter.
+type BitReader struct {
+	d        *Dictionary
+	data     []byte
+	pos      int    // next byte of data to load into acc
+	acc      uint64 // loaded bits, LSB first
+	bitCount uint   // number of loaded bits
+}
+
+// NewBitReader creates a BitReader decoding data with d.
+func NewBitReader(d *Dictionary, data []byte) *BitReader {
+	return &BitReader{d: d, data: data}
+}
+
+// Reset discards the state of r and makes it read from data.
+func (r *BitReader) Reset(data []byte) {
+	*r = BitReader{d: r.d, data: data}
+}
+
+func (r *BitReader) refill() {
+	for r.bitCount <= 56 && r.pos < len(r.data) {
+		r.acc |= uint64(r.data[r.pos]) << r.bitCount
+		r.pos++
+		r.bitCount += 8
+	}
+}
+
+// ReadSymbol reads one code and returns its symbol, a byte value or EofSymbol.
+// Reading on after EofSymbol is allowed, it has no special meaning here.
+func (r *BitReader) ReadSymbol() (int, error) {
+	d := r.d
+	if err := d.usable(ErrHuffmanDecompress); err != nil {
+		return 0, err
+	}
+	r.refill()
+	sym, codeLen, err := d.decodeSymbol(r.acc, r.bitCount)
+	if err != nil {
+		return 0, err
+	}
+	r.acc >>= codeLen
+	r.bitCount -= codeLen
+	return sym, nil
+}
+
+// ReadBits reads an n bit field written by WriteBits. n must not exceed 32.
+func (r *BitReader) ReadBits(n uint) (uint32, error) {
+	if n > maxBitField {
+		return 0, fmt.Errorf("%w: cannot read %d bits at once, maximum is %d", ErrHuffmanDecompress, n, maxBitField)
+	}
+	r.refill()
+	if n > r.bitCount {
+		return 0, fmt.Errorf("%w: truncated stream: need %d bits, have %d", ErrHuffmanDecompress, n, r.bitCount)
+	}
+	v := uint32(r.acc & (uint64(1)<<n - 1))
+	r.acc >>= n
+	r.bitCount -= n
+	return v, nil
+}
+
+// BitsRead returns the number of bits consumed from data.
+func (r *BitReader) BitsRead() int64 {
+	return int64(r.pos)*8 - int64(r.bitCount)
+}
+
+// decodeSymbol decodes the code at the bottom of acc, of which bitCount bits
+// are valid, and returns its symbol and length. Unlike the bulk decode loop
+// it checks every bit it consumes against bitCount, which is what the end of
+// a DecompressTo stream and BitReader need.
+func (d *Dictionary) decodeSymbol(acc uint64, bitCount uint) (sym int, codeLen uint, err error) {
+	entry := d.decLut[acc&lookupTableMask]
+	if codeLen = uint(entry & lutLenMask); codeLen != 0 {
+		// resolved straight out of the lookup table
+		if codeLen > bitCount {
+			return 0, 0, fmt.Errorf("%w: truncated stream: need %d bits, have %d", ErrHuffmanDecompress, codeLen, bitCount)
+		}
+		if entry&lutEOFBit != 0 {
+			return EofSymbol, codeLen, nil
+		}
+		return int(byte(entry >> lutSymShift)), codeLen, nil
+	}
+
+	// walk the tree bit by bit from where the lookup table landed
+	if bitCount < lookupTableBits {
+		return 0, 0, fmt.Errorf("%w: truncated stream: need %d bits, have %d", ErrHuffmanDecompress, lookupTableBits, bitCount)
+	}
+	nodes := &d.nodes
+	idx := entry >> lutNodeShift
+	acc >>= lookupTableBits
+	codeLen = lookupTableBits
+	for {
+		if codeLen == bitCount {
+			return 0, 0, fmt.Errorf("%w: truncated stream: symbol not terminated", ErrHuffmanDecompress)
+		}
+		idx = uint32(nodes[idx].Leafs[acc&1])
+		acc >>= 1
+		codeLen++
+
+		if idx >= uint32(len(nodes)) {
+			return 0, 0, fmt.Errorf("%w: invalid stream: walked off the tree", ErrHuffmanDecompress)
+		}
+		if nodes[idx].NumBits != 0 {
+			break
+		}
+	}
+	if idx == EofSymbol {
+		return EofSymbol, codeLen, nil
+	}
+	return int(nodes[idx].Symbol), codeLen, nil
+}
@@ -0,0 +1,139 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestBitWriterMatchesCompress: a stream written symbol by symbol is the one
+// Compress produces.
+func TestBitWriterMatchesCompress(t *testing.T) {
+	for _, dc := range testDictionaries() {
+		for _, payload := range [][]byte{nil, []byte("hello world"), snapshotLike(31, 1000), randomBytes(31, 1000)} {
+			want, err := NewHuffmanDict(dc.dict).Compress(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := NewBitWriter(dc.dict, nil)
+			for _, c := range payload {
+				if err := w.WriteSymbol(int(c)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.WriteSymbol(EofSymbol); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Bytes(); !bytes.Equal(got, want) {
+				t.Fatalf("%s, %d bytes: BitWriter = %x, want %x", dc.name, len(payload), got, want)
+			}
+
+			r := NewBitReader(dc.dict, want)
+			for i, c := range payload {
+				sym, err := r.ReadSymbol()
+				if err != nil || sym != int(c) {
+					t.Fatalf("%s: symbol %d = (%d, %v), want %d", dc.name, i, sym, err, c)
+				}
+			}
+			if sym, err := r.ReadSymbol(); err != nil || sym != EofSymbol {
+				t.Fatalf("%s: last symbol = (%d, %v), want EofSymbol", dc.name, sym, err)
+			}
+			if r.BitsRead() != w.BitsWritten() {
+				t.Fatalf("%s: BitsRead = %d, BitsWritten = %d", dc.name, r.BitsRead(), w.BitsWritten())
+			}
+		}
+	}
+}
+
+func TestBitWriterMixed(t *testing.T) {
+	type field struct {
+		sym  int // -1 for a raw field
+		v    uint32
+		bits uint
+	}
+	fields := []field{
+		{-1, 5, 3}, {'a', 0, 0}, {-1, 0xffffffff, 32}, {-1, 0, 0}, {0, 0, 0},
+		{-1, 1, 1}, {EofSymbol, 0, 0}, {-1, 0x1234, 13}, {0xff, 0, 0}, {-1, 0xdeadbeef, 32},
+	}
+
+	prefix := []byte{0xaa}
+	w := NewBitWriter(DefaultDictionary, prefix)
+	for _, f := range fields {
+		var err error
+		if f.sym < 0 {
+			err = w.WriteBits(f.v, f.bits)
+		} else {
+			err = w.WriteSymbol(f.sym)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := w.Bytes()
+	if out[0] != 0xaa || int64(len(out)-1) != (w.BitsWritten()+7)/8 {
+		t.Fatalf("Bytes = %x, want the prefix and %d bits", out, w.BitsWritten())
+	}
+
+	r := NewBitReader(DefaultDictionary, out[1:])
+	for i, f := range fields {
+		if f.sym < 0 {
+			v, err := r.ReadBits(f.bits)
+			if want := f.v & uint32(uint64(1)<<f.bits-1); err != nil || v != want {
+				t.Fatalf("field %d: ReadBits = (%#x, %v), want %#x", i, v, err, want)
+			}
+		} else if sym, err := r.ReadSymbol(); err != nil || sym != f.sym {
+			t.Fatalf("field %d: ReadSymbol = (%d, %v), want %d", i, sym, err, f.sym)
+		}
+	}
+	if r.BitsRead() != w.BitsWritten() {
+		t.Fatalf("BitsRead = %d, BitsWritten = %d", r.BitsRead(), w.BitsWritten())
+	}
+	if _, err := r.ReadBits(8); !errors.Is(err, ErrHuffmanDecompress) {
+		t.Fatalf("ReadBits past the end error = %v, want ErrHuffmanDecompress", err)
+	}
+
+	w.Reset(nil)
+	if len(w.Bytes()) != 0 || w.BitsWritten() != 0 {
+		t.Fatal("Reset kept state")
+	}
+}
+
+func TestBitWriterErrors(t *testing.T) {
+	w := NewBitWriter(DefaultDictionary, nil)
+	for _, sym := range []int{-1, EofSymbol + 1} {
+		if err := w.WriteSymbol(sym); !errors.Is(err, ErrHuffmanCompress) {
+			t.Fatalf("WriteSymbol(%d) error = %v, want ErrHuffmanCompress", sym, err)
+		}
+	}
+	if err := w.WriteBits(0, 33); !errors.Is(err, ErrHuffmanCompress) {
+		t.Fatalf("WriteBits(33) error = %v, want ErrHuffmanCompress", err)
+	}
+	if err := NewBitWriter(nil, nil).WriteSymbol(0); !errors.Is(err, ErrHuffmanCompress) {
+		t.Fatalf("nil dictionary error = %v, want ErrHuffmanCompress", err)
+	}
+	if len(w.Bytes()) != 0 {
+		t.Fatal("failed writes produced output")
+	}
+
+	if _, err := NewBitReader(DefaultDictionary, nil).ReadBits(33); !errors.Is(err, ErrHuffmanDecompress) {
+		t.Fatalf("ReadBits(33) error = %v, want ErrHuffmanDecompress", err)
+	}
+	if _, err := NewBitReader(&Dictionary{}, []byte{1}).ReadSymbol(); !errors.Is(err, ErrHuffmanDecompress) {
+		t.Fatalf("uninitialized dictionary error = %v, want ErrHuffmanDecompress", err)
+	}
+	for _, in := range malformedInputs() {
+		r := NewBitReader(DefaultDictionary, in.data)
+		for {
+			sym, err := r.ReadSymbol()
+			if err != nil {
+				if !errors.Is(err, ErrHuffmanDecompress) {
+					t.Fatalf("%s: error = %v, want ErrHuffmanDecompress", in.name, err)
+				}
+				break
+			}
+			if sym == EofSymbol {
+				break
+			}
+		}
+	}
+}
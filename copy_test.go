@@ -0,0 +1,171 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReaderWriteTo(t *testing.T) {
+	for _, e := range regressionCorpus() {
+		compressed, err := Compress(e.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		n, err := NewReader(bytes.NewReader(compressed)).WriteTo(&buf)
+		if err != nil || n != int64(len(e.data)) || !bytes.Equal(buf.Bytes(), e.data) {
+			t.Fatalf("%s: WriteTo = (%d, %v), want (%d, nil) and the payload", e.name, n, err, len(e.data))
+		}
+	}
+
+	// errors are those of Read
+	_, cases := trailerCases(t)
+	for _, c := range cases {
+		r := NewReader(bytes.NewReader(c.data), WithStrict(true))
+		if _, err := r.WriteTo(io.Discard); c.strict != (err == nil) || !c.strict && !errors.Is(err, ErrTrailingData) {
+			t.Fatalf("%s: strict WriteTo error = %v", c.name, err)
+		}
+	}
+	payload := snapshotLike(34, 5000)
+	compressed, err := Compress(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := NewReader(bytes.NewReader(compressed), WithOutputLimit(4999)).WriteTo(io.Discard); n != 4999 || !errors.Is(err, ErrOutputLimit) {
+		t.Fatalf("WriteTo over the limit = (%d, %v), want (4999, ErrOutputLimit)", n, err)
+	}
+	if _, err := NewReader(bytes.NewReader(compressed)).WriteTo(shortWriter{}); !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("WriteTo to a short writer error = %v, want io.ErrShortWrite", err)
+	}
+	if _, err := NewReader(bytes.NewReader(compressed[:len(compressed)/2])).WriteTo(io.Discard); !errors.Is(err, ErrHuffmanDecompress) {
+		t.Fatalf("WriteTo of a truncated stream error = %v, want ErrHuffmanDecompress", err)
+	}
+}
+
+func TestReaderWriteToDirect(t *testing.T) {
+	prefix := []byte("already buffered ")
+	for _, e := range regressionCorpus() {
+		compressed, err := Compress(e.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := append(append([]byte(nil), prefix...), e.data...)
+
+		r := NewReader(bytes.NewReader(compressed))
+		buf := bytes.NewBuffer(append([]byte(nil), prefix...))
+		if n, err := r.WriteTo(buf); err != nil || n != int64(len(e.data)) || !bytes.Equal(buf.Bytes(), want) {
+			t.Fatalf("%s: WriteTo a bytes.Buffer = (%d, %v), want (%d, nil) and the payload", e.name, n, err, len(e.data))
+		}
+		if r.out != nil {
+			t.Fatalf("%s: WriteTo a bytes.Buffer staged its output", e.name)
+		}
+
+		for _, size := range []int{16, 4096, 1 << 20} {
+			var out bytes.Buffer
+			bw := bufio.NewWriterSize(&out, size)
+			if _, err := bw.Write(prefix); err != nil {
+				t.Fatal(err)
+			}
+			r.Reset(bytes.NewReader(compressed))
+			n, err := r.WriteTo(bw)
+			if err == nil {
+				err = bw.Flush()
+			}
+			if err != nil || n != int64(len(e.data)) || !bytes.Equal(out.Bytes(), want) {
+				t.Fatalf("%s: WriteTo a bufio.Writer of %d bytes = (%d, %v), want (%d, nil) and the payload", e.name, size, n, err, len(e.data))
+			}
+		}
+		if r.out != nil {
+			t.Fatalf("%s: WriteTo a bufio.Writer staged its output", e.name)
+		}
+	}
+
+	// a failing flush of the bufio.Writer is a write error
+	compressed, err := Compress(snapshotLike(35, 5000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReader(bytes.NewReader(compressed)).WriteTo(bufio.NewWriterSize(shortWriter{}, 16)); !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("WriteTo a bufio.Writer over a short writer error = %v, want io.ErrShortWrite", err)
+	}
+}
+
+func TestReaderWriteToAllocs(t *testing.T) {
+	payload := snapshotLike(36, 5000)
+	compressed, err := Compress(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := bytes.NewReader(compressed)
+	r := NewReader(src)
+	buf := bytes.NewBuffer(make([]byte, 0, len(payload)+copyBufSize))
+	allocs := testing.AllocsPerRun(10, func() {
+		src.Reset(compressed)
+		r.Reset(src)
+		buf.Reset()
+		if _, err := r.WriteTo(buf); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 || !bytes.Equal(buf.Bytes(), payload) {
+		t.Fatalf("WriteTo a bytes.Buffer allocated %.0f times", allocs)
+	}
+}
+
+func TestWriterReadFrom(t *testing.T) {
+	for _, e := range regressionCorpus() {
+		want, err := Compress(e.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, src := range map[string]io.Reader{
+			"WriterTo": bytes.NewReader(e.data),
+			"Reader":   iotest.HalfReader(bytes.NewReader(e.data)),
+		} {
+			var buf bytes.Buffer
+			w := NewWriter(&buf, WithBufferSize(16))
+			// io.Copy prefers the source's WriteTo and would not get here
+			// for bytes.Reader
+			n, err := w.ReadFrom(src)
+			if err != nil || n != int64(len(e.data)) {
+				t.Fatalf("%s/%s: ReadFrom = (%d, %v), want (%d, nil)", e.name, name, n, err, len(e.data))
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Fatalf("%s/%s: ReadFrom output differs from Compress", e.name, name)
+			}
+		}
+	}
+
+	payload := snapshotLike(34, 5000)
+	compressed, err := Compress(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var copied bytes.Buffer
+	if _, err := io.Copy(NewWriter(&copied), iotest.OneByteReader(bytes.NewReader(payload))); err != nil || !bytes.Equal(copied.Bytes(), compressed) {
+		t.Fatalf("io.Copy into a Writer = %v, want a single stream", err)
+	}
+
+	w := NewWriter(io.Discard, WithOutputLimit(int64(len(compressed)-1)))
+	if _, err := w.ReadFrom(iotest.HalfReader(bytes.NewReader(payload))); !errors.Is(err, ErrOutputLimit) {
+		t.Fatalf("ReadFrom over the limit error = %v, want ErrOutputLimit", err)
+	}
+	errSource := errors.New("source failed")
+	if _, err := w.ReadFrom(iotest.ErrReader(errSource)); !errors.Is(err, errSource) {
+		t.Fatalf("ReadFrom error = %v, want the source's", err)
+	}
+
+	// the Writer keeps working for Write afterwards
+	var buf bytes.Buffer
+	w.Reset(&buf)
+	if _, err := w.Write([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := Compress([]byte("hello world")); !bytes.Equal(buf.Bytes(), want) {
+		t.Fatal("Write after ReadFrom differs from Compress")
+	}
+}
@@ -84,6 +84,43 @@ func TestDDNetCompat(t *testing.T) {
 		}
 	})
 
+	t.Run("teeworlds 0.7 trailing null", func(t *testing.T) {
+		// LegacyPadding reproduces the teeworlds 0.7 form of the two cases
+		// above: the extra 0x00 where the EOF symbol is byte-aligned, and
+		// the unchanged output where it is not.
+		legacy := &Huffman{Dictionary: DefaultDictionary, LegacyPadding: true}
+
+		aligned := make([]byte, 64)
+		aligned[0] = 0x15
+		unaligned := make([]byte, 64)
+		for i := range 8 {
+			unaligned[i] = byte(i)
+		}
+		for _, c := range []struct {
+			in, want []byte
+		}{
+			{aligned, []byte{0xBE, 0xFD, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x15, 0x37, 0x00}},
+			{unaligned, []byte{0x51, 0x58, 0x78, 0x76, 0x1B, 0xB7, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F, 0xC5, 0x0D}},
+		} {
+			got, err := legacy.Compress(c.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, c.want) {
+				t.Errorf("legacy Compress = %x, want %x", got, c.want)
+			}
+
+			var buf bytes.Buffer
+			w := NewWriter(&buf, WithLegacyPadding(true))
+			if _, err := w.Write(c.in); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), c.want) {
+				t.Errorf("legacy Writer = %x, want %x", buf.Bytes(), c.want)
+			}
+		}
+	})
+
 	t.Run("rejects fuzz vectors", func(t *testing.T) {
 		// ddnet TEST(Huffman, DecompressionTableLookupIntegerOverflow):
 		// fuzz-found inputs that underflowed the bit counter. All three must
@@ -0,0 +1,149 @@
+// Package demo reads and writes teeworlds and ddnet demo files: the header,
+// the timeline markers, the map the demo was recorded on and the stream of
+// chunks that follows. Tick markers in the stream separate the ticks; the data
+// chunks between them hold a whole snapshot, the delta to the previous
+// snapshot or a net message, each packed with CVariableInt::Compress and then
+// Huffman compressed with the default dictionary. It follows CDemoPlayer and
+// CDemoRecorder of ddnet, whose player reads the demos of teeworlds 0.6 and
+// 0.7 as well.
+package demo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/teeworlds-go/huffman/v2/msg"
+	"github.com/teeworlds-go/huffman/v2/snapshot"
+)
+
+var (
+	ErrInvalidDemo = errors.New("invalid demo")
+)
+
+const (
+	// MaxTimelineMarkers is the most timeline markers a demo holds.
+	MaxTimelineMarkers = 64
+
+	// maxDataSize is CSnapshot::MAX_SIZE, the size of the buffers the
+	// reference player decompresses a chunk into, in either step.
+	maxDataSize = 64 << 10
+)
+
+// The demo format versions, in the header right after the marker.
+const (
+	// versionOld is the oldest version ddnet plays, which has no timeline
+	// markers yet.
+	versionOld = 3
+	// versionMarkers adds the timeline markers after the header.
+	versionMarkers = 4
+	// versionTickCompression changes how tick markers store small tick
+	// steps, see readTick.
+	versionTickCompression = 5
+	// versionSHA256 allows the map SHA256 extension after the markers.
+	versionSHA256 = 6
+)
+
+const (
+	headerSize = 7 + 1 + 64 + 64 + 4 + 4 + 8 + 4 + 20
+	// markersSize is the size of the timeline markers: their number and
+	// room for MaxTimelineMarkers ticks, all big-endian.
+	markersSize = 4 + 4*MaxTimelineMarkers
+)
+
+// headerMarker starts every demo file.
+var headerMarker = [7]byte{'T', 'W', 'D', 'E', 'M', 'O', 0}
+
+// sha256Extension is the SHA256_EXTENSION UUID ddnet writes after the
+// timeline markers, followed by the SHA256 of the map.
+var sha256Extension = msg.UUID{0x6b, 0xe6, 0xda, 0x4a, 0xce, 0xbd, 0x38, 0x0c, 0x9b, 0x5b, 0x12, 0x89, 0xc8, 0x42, 0xd7, 0x80}
+
+// The bits of the first byte of a chunk.
+const (
+	// chunkTickMarker marks a tick marker, all other chunks carry data.
+	chunkTickMarker = 0x80
+	// tickKeyframe marks a tick marker that starts with a whole snapshot.
+	tickKeyframe = 0x40
+	// tickCompressed marks a tick marker that stores the step from the
+	// previous tick in tickMask rather than the tick in four more bytes.
+	tickCompressed = 0x20
+	tickMask       = 0x1f
+	// tickMaskLegacy holds the step before versionTickCompression, zero
+	// meaning the tick follows.
+	tickMaskLegacy = 0x3f
+
+	chunkTypeShift = 5
+	chunkTypeMask  = 0x3
+	// chunkSizeMask holds the size of the data, or one of the two values
+	// below that say it follows in one or two little-endian bytes.
+	chunkSizeMask = 0x1f
+	chunkSize8    = 30
+	chunkSize16   = 31
+)
+
+// Header is the header at the start of a demo file.
+type Header struct {
+	// Version is the version of the demo format, 3 to 6.
+	Version int
+	// NetVersion is the network version of the recording game, such as
+	// "0.6 626fce9a778df4d4".
+	NetVersion string
+	MapName    string
+	// MapSize is the size of the map file embedded in the demo, MapCrc its
+	// CRC32.
+	MapSize int
+	MapCrc  uint32
+	// Type is "client" for a demo recorded by a client, "server" for one
+	// recorded by a server.
+	Type string
+	// Length is the length of the demo in seconds.
+	Length int
+	// Timestamp is the local time the recording started, formatted like
+	// "2024-05-01_18-30-00".
+	Timestamp string
+}
+
+// ChunkType is the type of a chunk in the stream. Those of data chunks are
+// the CHUNKTYPE values of the reference implementations.
+type ChunkType int
+
+const (
+	ChunkTick ChunkType = iota
+	ChunkSnapshot
+	ChunkMessage
+	ChunkDelta
+)
+
+func (t ChunkType) String() string {
+	switch t {
+	case ChunkTick:
+		return "tick"
+	case ChunkSnapshot:
+		return "snapshot"
+	case ChunkMessage:
+		return "message"
+	case ChunkDelta:
+		return "delta"
+	}
+	return fmt.Sprintf("ChunkType(%d)", int(t))
+}
+
+// Chunk is one chunk of the stream.
+type Chunk struct {
+	Type ChunkType
+	// Tick is the tick a tick marker starts. Data chunks belong to the tick
+	// of the last tick marker before them, -1 if there is none.
+	Tick int
+	// Keyframe is set for a tick marker the player can seek to, which a
+	// whole snapshot follows.
+	Keyframe bool
+
+	// Data is the content of a data chunk. A message has its packed fields
+	// here, header first, with up to three zero bytes of padding to a
+	// multiple of four. A delta is here in the CVariableInt packed form
+	// snapshot.ParseDelta reads; it applies to the snapshot of the previous
+	// snapshot or delta chunk. A snapshot is here as the little-endian ints
+	// of a CSnapshot, see Snapshot.
+	Data []byte
+	// Snapshot is the decoded snapshot of a snapshot chunk.
+	Snapshot *snapshot.Snapshot
+}
@@ -0,0 +1,273 @@
+package demo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+
+	"github.com/teeworlds-go/huffman/v2"
+	"github.com/teeworlds-go/huffman/v2/snapshot"
+)
+
+// Reader reads a demo file. NewReader reads everything in front of the chunk
+// stream, which Next and Chunks then read chunk by chunk.
+type Reader struct {
+	r         *bufio.Reader
+	header    Header
+	markers   []int
+	mapSHA256 [32]byte
+	hasSHA256 bool
+	mapData   []byte
+
+	tick int
+	// raw holds the compressed data of the current chunk, buf the data
+	// Huffman decompressed and ints buf unpacked with CVariableInt. All three
+	// are reused from chunk to chunk.
+	raw  []byte
+	buf  []byte
+	ints []byte
+}
+
+// NewReader reads the header, the timeline markers, the map SHA256 if the
+// demo has one and the map from r, as CDemoPlayer::Load does.
+func NewReader(r io.Reader) (*Reader, error) {
+	dr := &Reader{r: bufio.NewReader(r), tick: -1}
+
+	var b [headerSize]byte
+	if err := dr.readFull(b[:], "header"); err != nil {
+		return nil, err
+	}
+	if [7]byte(b[:7]) != headerMarker {
+		return nil, fmt.Errorf("%w: no demo marker", ErrInvalidDemo)
+	}
+	h := Header{
+		Version:    int(b[7]),
+		NetVersion: cstring(b[8:72]),
+		MapName:    cstring(b[72:136]),
+		MapSize:    int(be32(b[136:])),
+		MapCrc:     be32(b[140:]),
+		Type:       cstring(b[144:152]),
+		Length:     int(be32(b[152:])),
+		Timestamp:  cstring(b[156:176]),
+	}
+	if h.Version < versionOld || h.Version > versionSHA256 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidDemo, h.Version)
+	}
+	if h.MapSize < 0 {
+		return nil, fmt.Errorf("%w: map size %d", ErrInvalidDemo, h.MapSize)
+	}
+	dr.header = h
+
+	if h.Version >= versionMarkers {
+		var m [markersSize]byte
+		if err := dr.readFull(m[:], "timeline markers"); err != nil {
+			return nil, err
+		}
+		n := min(int(be32(m[:])), MaxTimelineMarkers)
+		for i := range n {
+			dr.markers = append(dr.markers, int(int32(be32(m[4+4*i:]))))
+		}
+	}
+
+	if h.Version >= versionSHA256 {
+		// the extension is optional; without it the map follows at once
+		if ext, err := dr.r.Peek(len(sha256Extension)); err == nil && [16]byte(ext) == sha256Extension {
+			dr.r.Discard(len(sha256Extension))
+			if err := dr.readFull(dr.mapSHA256[:], "map SHA256"); err != nil {
+				return nil, err
+			}
+			dr.hasSHA256 = true
+		}
+	}
+
+	// the size is not trusted with an allocation up front
+	var m bytes.Buffer
+	if n, err := io.CopyN(&m, dr.r, int64(h.MapSize)); err != nil {
+		return nil, fmt.Errorf("%w: map of %d bytes, have %d: %w", ErrInvalidDemo, h.MapSize, n, unexpected(err))
+	}
+	dr.mapData = m.Bytes()
+	return dr, nil
+}
+
+// Header returns the header of the demo.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Markers returns the ticks of the timeline markers, which a player sets while
+// recording to find scenes again. It is empty before version 4.
+func (r *Reader) Markers() []int {
+	return r.markers
+}
+
+// MapSHA256 returns the SHA256 of the map and whether the demo has one, which
+// ddnet adds from version 6.
+func (r *Reader) MapSHA256() ([32]byte, bool) {
+	return r.mapSHA256, r.hasSHA256
+}
+
+// Map returns the map file embedded in the demo, Header().MapSize bytes.
+func (r *Reader) Map() []byte {
+	return r.mapData
+}
+
+// Next reads the next chunk. At the end of the stream it returns io.EOF; a
+// stream that ends inside a chunk, as the demos of a crashed recorder do, is
+// an error wrapping io.ErrUnexpectedEOF. The Data of the chunk is only valid
+// until the next call.
+func (r *Reader) Next() (Chunk, error) {
+	b, err := r.r.ReadByte()
+	if err == io.EOF {
+		return Chunk{}, io.EOF
+	}
+	if err != nil {
+		return Chunk{}, fmt.Errorf("%w: chunk: %w", ErrInvalidDemo, err)
+	}
+	if b&chunkTickMarker != 0 {
+		return r.readTick(b)
+	}
+
+	c := Chunk{Type: ChunkType(b >> chunkTypeShift & chunkTypeMask), Tick: r.tick}
+	if c.Type == ChunkTick {
+		return Chunk{}, fmt.Errorf("%w: data chunk of type 0 at tick %d", ErrInvalidDemo, r.tick)
+	}
+	size := int(b & chunkSizeMask)
+	switch size {
+	case chunkSize8:
+		var s [1]byte
+		if err := r.readFull(s[:], "chunk size"); err != nil {
+			return Chunk{}, err
+		}
+		size = int(s[0])
+	case chunkSize16:
+		var s [2]byte
+		if err := r.readFull(s[:], "chunk size"); err != nil {
+			return Chunk{}, err
+		}
+		size = int(s[0]) | int(s[1])<<8
+	}
+	if cap(r.raw) < size {
+		r.raw = make([]byte, size)
+	}
+	r.raw = r.raw[:size]
+	if err := r.readFull(r.raw, c.Type.String()+" chunk"); err != nil {
+		return Chunk{}, err
+	}
+
+	buf, err := defaultHuffman.DecompressTo(r.buf[:0], r.raw)
+	if err != nil {
+		return Chunk{}, fmt.Errorf("%w: %s chunk at tick %d: %w", ErrInvalidDemo, c.Type, r.tick, err)
+	}
+	r.buf = buf
+
+	// CDemoPlayer unpacks deltas as well, so they are held to the same size
+	r.ints, err = huffman.DecompressVarInt(r.ints[:0], r.buf)
+	if err != nil {
+		return Chunk{}, fmt.Errorf("%w: %s chunk at tick %d: %w", ErrInvalidDemo, c.Type, r.tick, err)
+	}
+	if len(r.ints) > maxDataSize {
+		return Chunk{}, fmt.Errorf("%w: %s chunk at tick %d unpacks to %d bytes, more than %d", ErrInvalidDemo, c.Type, r.tick, len(r.ints), maxDataSize)
+	}
+	if c.Type == ChunkDelta {
+		// deltas are read in their packed form
+		c.Data = r.buf
+		return c, nil
+	}
+	c.Data = r.ints
+	if c.Type == ChunkSnapshot {
+		c.Snapshot = &snapshot.Snapshot{}
+		if err := c.Snapshot.UnmarshalBinary(c.Data); err != nil {
+			return Chunk{}, fmt.Errorf("%w: snapshot at tick %d: %w", ErrInvalidDemo, r.tick, err)
+		}
+	}
+	return c, nil
+}
+
+// readTick reads the rest of the tick marker starting with b. Since
+// versionTickCompression, tickCompressed says the step from the previous tick
+// is in the low bits; before, any step in the low bits was taken. Otherwise
+// the tick follows in four big-endian bytes.
+func (r *Reader) readTick(b byte) (Chunk, error) {
+	step := -1
+	switch {
+	case r.header.Version < versionTickCompression && b&tickMaskLegacy != 0:
+		step = int(b & tickMaskLegacy)
+	case r.header.Version >= versionTickCompression && b&tickCompressed != 0:
+		step = int(b & tickMask)
+	}
+	if step >= 0 {
+		// a step needs a tick to start from, as the reference player
+		// rejects negative ticks
+		if r.tick < 0 {
+			return Chunk{}, fmt.Errorf("%w: tick step of %d before the first tick", ErrInvalidDemo, step)
+		}
+		r.tick += step
+	} else {
+		var t [4]byte
+		if err := r.readFull(t[:], "tick"); err != nil {
+			return Chunk{}, err
+		}
+		tick := int(int32(be32(t[:])))
+		if tick < 0 {
+			return Chunk{}, fmt.Errorf("%w: negative tick %d", ErrInvalidDemo, tick)
+		}
+		r.tick = tick
+	}
+	return Chunk{Type: ChunkTick, Tick: r.tick, Keyframe: b&tickKeyframe != 0}, nil
+}
+
+// Chunks iterates over the rest of the stream, see Next. An error is yielded
+// once as the last pair with a zero Chunk; the end of the stream is none.
+func (r *Reader) Chunks() iter.Seq2[Chunk, error] {
+	return func(yield func(Chunk, error) bool) {
+		for {
+			c, err := r.Next()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(Chunk{}, err)
+				return
+			}
+			if !yield(c, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (r *Reader) readFull(dst []byte, what string) error {
+	if _, err := io.ReadFull(r.r, dst); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidDemo, what, unexpected(err))
+	}
+	return nil
+}
+
+// unexpected turns io.EOF into io.ErrUnexpectedEOF, for reads that may not
+// end the demo.
+func unexpected(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// defaultHuffman decompresses the chunks, never to more than the reference
+// player would. It is never modified.
+var defaultHuffman = *huffman.NewHuffman(huffman.WithOutputLimit(maxDataSize))
+
+// cstring returns the string in b up to its first zero byte.
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func be32(b []byte) uint32 {
+	_ = b[3]
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
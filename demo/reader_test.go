@@ -0,0 +1,428 @@
+package demo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/teeworlds-go/huffman/v2"
+	"github.com/teeworlds-go/huffman/v2/msg"
+	"github.com/teeworlds-go/huffman/v2/packet"
+	"github.com/teeworlds-go/huffman/v2/snapshot"
+)
+
+var testHeader = Header{
+	Version:    6,
+	NetVersion: "0.6 626fce9a778df4d4",
+	MapName:    "ctf5",
+	MapSize:    5,
+	MapCrc:     0xdeadbeef,
+	Type:       "client",
+	Length:     42,
+	Timestamp:  "2024-05-01_18-30-00",
+}
+
+var testMap = []byte("map\x00\x01")
+
+// demoStart returns the start of a demo in front of its chunk stream, laid
+// out by hand the way CDemoRecorder::Start writes it. The map SHA256 is only
+// written if sha is given.
+func demoStart(h Header, markers []int, sha []byte, mapData []byte) []byte {
+	field := func(b []byte, s string, n int) []byte {
+		return append(b, append([]byte(s), make([]byte, n-len(s))...)...)
+	}
+	b := append([]byte("TWDEMO\x00"), byte(h.Version))
+	b = field(b, h.NetVersion, 64)
+	b = field(b, h.MapName, 64)
+	b = binary.BigEndian.AppendUint32(b, uint32(h.MapSize))
+	b = binary.BigEndian.AppendUint32(b, h.MapCrc)
+	b = field(b, h.Type, 8)
+	b = binary.BigEndian.AppendUint32(b, uint32(h.Length))
+	b = field(b, h.Timestamp, 20)
+	if h.Version >= 4 {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(markers)))
+		for i := range MaxTimelineMarkers {
+			tick := 0
+			if i < len(markers) {
+				tick = markers[i]
+			}
+			b = binary.BigEndian.AppendUint32(b, uint32(tick))
+		}
+	}
+	if sha != nil {
+		b = append(b, sha256Extension[:]...)
+		b = append(b, sha...)
+	}
+	return append(b, mapData...)
+}
+
+// unhex returns the bytes of the hex string s, ignoring spaces.
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// leInts returns vs as little-endian ints, the way a CSnapshot sits in memory.
+func leInts(vs ...int32) []byte {
+	var b []byte
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint32(b, uint32(v))
+	}
+	return b
+}
+
+func testSnapshot(t *testing.T, items ...snapshot.Item) *snapshot.Snapshot {
+	t.Helper()
+	var s snapshot.Snapshot
+	for _, item := range items {
+		if err := s.Add(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &s
+}
+
+func sameItems(a, b *snapshot.Snapshot) bool {
+	return slices.EqualFunc(a.Items(), b.Items(), func(x, y snapshot.Item) bool {
+		return x.Key() == y.Key() && slices.Equal(x.Data, y.Data)
+	})
+}
+
+func TestReader(t *testing.T) {
+	first := testSnapshot(t,
+		snapshot.Item{Type: 1, ID: 0, Data: []int32{1, 2}},
+		snapshot.Item{Type: 2, ID: 3, Data: []int32{5}},
+	)
+	second := testSnapshot(t,
+		snapshot.Item{Type: 1, ID: 0, Data: []int32{1, 7}},
+		snapshot.Item{Type: 4, ID: 1, Data: []int32{-9, 0, 9}},
+	)
+	var p msg.Packer
+	p.AddHeader(packet.Version06, msg.Header{ID: 3})
+	p.AddString("hello", 0)
+	message := p.Bytes()
+
+	// a chat message large enough for the one-byte form of the chunk size;
+	// testdata/v6.demo has the two-byte one
+	medium := []byte("\x06\x00\x40the quick brown fox jumps over the lazy dog\x00")
+
+	// the data chunks as CDemoRecorder::Write builds them: padded to whole
+	// ints, packed with CVariableInt and Huffman compressed, behind the chunk
+	// type and size; go run testdata/gen.go -chunks prints them
+	sha := bytes.Repeat([]byte{0xab}, 32)
+	file := demoStart(testHeader, []int{150, 160}, sha, testMap)
+	file = append(file, 0xc0, 0, 0, 0, 100)                           // keyframe at tick 100
+	file = append(file, unhex(t, "2c f0a21c0082c26f406d57dc00")...)   // first
+	file = append(file, 0xa1)                                         // one tick on
+	file = append(file, unhex(t, "6d 28fa0da8b168f7d082af4cc50d")...) // the delta to second
+	file = append(file, unhex(t, "4b 52f851ef438e34172c1437")...)     // message
+	file = append(file, 0x80, 0, 0, 0, 200)
+	file = append(file, unhex(t, "5e 48 5200e0647a6d8af98d05bd8918e84aa1c34f0b4cbed271b9cbfce69ae5bea3"+
+		"4abff9ec98c8447e73393d3f5eaea21a395c3f3574b5c3c04faa9421e700057ee371b9ef7c6ca1b801")...)
+
+	r, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Header() != testHeader {
+		t.Errorf("Header = %+v\nwant     %+v", r.Header(), testHeader)
+	}
+	if !slices.Equal(r.Markers(), []int{150, 160}) {
+		t.Errorf("Markers = %v", r.Markers())
+	}
+	if got, ok := r.MapSHA256(); !ok || !bytes.Equal(got[:], sha) {
+		t.Errorf("MapSHA256 = %x, %v", got, ok)
+	}
+	if !bytes.Equal(r.Map(), testMap) {
+		t.Errorf("Map = %q", r.Map())
+	}
+
+	var chunks []Chunk
+	for c, err := range r.Chunks() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Data = slices.Clone(c.Data)
+		chunks = append(chunks, c)
+	}
+	want := []struct {
+		typ      ChunkType
+		tick     int
+		keyframe bool
+	}{
+		{ChunkTick, 100, true},
+		{ChunkSnapshot, 100, false},
+		{ChunkTick, 101, false},
+		{ChunkDelta, 101, false},
+		{ChunkMessage, 101, false},
+		{ChunkTick, 200, false},
+		{ChunkMessage, 200, false},
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("got %d chunks, want %d", len(chunks), len(want))
+	}
+	for i, w := range want {
+		if c := chunks[i]; c.Type != w.typ || c.Tick != w.tick || c.Keyframe != w.keyframe {
+			t.Errorf("chunk %d = %s at %d, keyframe %v, want %s at %d, keyframe %v", i, c.Type, c.Tick, c.Keyframe, w.typ, w.tick, w.keyframe)
+		}
+	}
+
+	if s := chunks[1].Snapshot; s == nil || !sameItems(s, first) {
+		t.Errorf("snapshot = %v, want %v", s, first.Items())
+	}
+	got, err := snapshot.UnpackDelta(chunks[1].Snapshot, chunks[3].Data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameItems(got, second) {
+		t.Errorf("delta gives %v, want %v", got.Items(), second.Items())
+	}
+
+	u := msg.NewUnpacker(chunks[4].Data)
+	h := u.UnpackHeader(packet.Version06)
+	if s := u.String(msg.Sanitize); u.Err() != nil || h.ID != 3 || s != "hello" {
+		t.Errorf("message %+v %q, %v", h, s, u.Err())
+	}
+	if len(chunks[4].Data)%4 != 0 || !bytes.HasPrefix(chunks[4].Data, message) {
+		t.Errorf("message data %x, want %x padded", chunks[4].Data, message)
+	}
+	if !bytes.Equal(chunks[6].Data, append(medium, 0)) {
+		t.Errorf("message data %x, want %x padded", chunks[6].Data, medium)
+	}
+
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("Next at the end: err = %v, want io.EOF", err)
+	}
+}
+
+// testdata/v6.demo is a ddnet client demo of version 6 that testdata/gen.go
+// lays out byte by byte after ddnet's CDemoRecorder, not with this package: a
+// keyframe with a chat message, deltas behind compressed and full tick
+// markers, a tick whose delta was left out with messages in both longer forms
+// of the chunk size and a second keyframe, on a stand-in map.
+func TestReaderTestdata(t *testing.T) {
+	file, err := os.ReadFile("testdata/v6.demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Header{
+		Version:    6,
+		NetVersion: "0.6 626fce9a778df4d4",
+		MapName:    "ctf1",
+		MapSize:    64,
+		MapCrc:     0xa6ba312f,
+		Type:       "client",
+		Length:     5,
+		Timestamp:  "2026-10-19_12-00-00",
+	}
+	if r.Header() != want {
+		t.Errorf("Header = %+v\nwant     %+v", r.Header(), want)
+	}
+	if !slices.Equal(r.Markers(), []int{120}) {
+		t.Errorf("Markers = %v", r.Markers())
+	}
+	sha, ok := r.MapSHA256()
+	if !ok || sha != sha256.Sum256(r.Map()) || crc32.ChecksumIEEE(r.Map()) != want.MapCrc || len(r.Map()) != want.MapSize {
+		t.Errorf("map of %d bytes does not match its SHA256 %x, %v and the header", len(r.Map()), sha, ok)
+	}
+
+	var chunks []Chunk
+	for c, err := range r.Chunks() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Data = slices.Clone(c.Data)
+		chunks = append(chunks, c)
+	}
+	wantChunks := []struct {
+		typ      ChunkType
+		tick     int
+		keyframe bool
+	}{
+		{ChunkTick, 100, true},
+		{ChunkSnapshot, 100, false},
+		{ChunkMessage, 100, false},
+		{ChunkTick, 101, false},
+		{ChunkDelta, 101, false},
+		{ChunkTick, 102, false},
+		{ChunkMessage, 102, false},
+		{ChunkMessage, 102, false},
+		{ChunkTick, 140, false},
+		{ChunkDelta, 140, false},
+		{ChunkTick, 351, true},
+		{ChunkSnapshot, 351, false},
+	}
+	if len(chunks) != len(wantChunks) {
+		t.Fatalf("got %d chunks, want %d", len(chunks), len(wantChunks))
+	}
+	for i, w := range wantChunks {
+		if c := chunks[i]; c.Type != w.typ || c.Tick != w.tick || c.Keyframe != w.keyframe {
+			t.Errorf("chunk %d = %s at %d, keyframe %v, want %s at %d, keyframe %v", i, c.Type, c.Tick, c.Keyframe, w.typ, w.tick, w.keyframe)
+		}
+	}
+
+	// NETMSGTYPE_SV_CHAT to everyone from the server
+	u := msg.NewUnpacker(chunks[2].Data)
+	h := u.UnpackHeader(packet.Version06)
+	team, client, text := u.Int(), u.Int(), u.String(msg.Sanitize)
+	if u.Err() != nil || h.ID != 3 || h.System || team != 0 || client != -1 || text != "hello" {
+		t.Errorf("chat message %+v %d %d %q, %v", h, team, client, text, u.Err())
+	}
+	if !bytes.Equal(chunks[2].Data, []byte{0x06, 0x00, 0x40, 'h', 'e', 'l', 'l', 'o', 0, 0, 0, 0}) {
+		t.Errorf("chat message data %x", chunks[2].Data)
+	}
+
+	u.Reset(chunks[6].Data)
+	h = u.UnpackHeader(packet.Version06)
+	team, client, text = u.Int(), u.Int(), u.String(msg.Sanitize)
+	if u.Err() != nil || h.ID != 3 || team != 0 || client != -1 || text != "the quick brown fox jumps over the lazy dog" {
+		t.Errorf("chat message %+v %d %d %q, %v", h, team, client, text, u.Err())
+	}
+	// NETMSGTYPE_SV_MOTD
+	u.Reset(chunks[7].Data)
+	h = u.UnpackHeader(packet.Version06)
+	motd := u.String(msg.Sanitize)
+	if u.Err() != nil || h.ID != 1 || motd != strings.Repeat("welcome to the server, have fun and play fair. ", 8) {
+		t.Errorf("motd %+v %q, %v", h, motd, u.Err())
+	}
+
+	gameInfo := snapshot.Item{Type: 6, ID: 0, Data: []int32{0, 0, 100, 0, 20, 0, 0, 0}}
+	steps := []*snapshot.Snapshot{
+		testSnapshot(t,
+			gameInfo,
+			snapshot.Item{Type: 9, ID: 0, Data: []int32{100, 1024, 576, 0, 128, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 0, 10, 1, 0, 0}},
+			snapshot.Item{Type: 10, ID: 0, Data: []int32{1, 0, 0, 0, 25}},
+		),
+		testSnapshot(t,
+			gameInfo,
+			snapshot.Item{Type: 9, ID: 0, Data: []int32{101, 1030, 580, 256, 192, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 0, 10, 1, 0, 0}},
+			snapshot.Item{Type: 10, ID: 0, Data: []int32{1, 0, 0, 0, 27}},
+		),
+		testSnapshot(t,
+			gameInfo,
+			snapshot.Item{Type: 10, ID: 0, Data: []int32{1, 0, 0, -1, 27}},
+			snapshot.Item{Type: 17, ID: 0, Data: []int32{1040, 600, 0}},
+		),
+	}
+	if !sameItems(chunks[1].Snapshot, steps[0]) {
+		t.Fatalf("snapshot at 100 = %v, want %v", chunks[1].Snapshot.Items(), steps[0].Items())
+	}
+	sizes := snapshot.Vanilla06().ItemSizes()
+	s := chunks[1].Snapshot
+	for i, c := range []Chunk{chunks[4], chunks[9]} {
+		if s, err = snapshot.UnpackDelta(s, c.Data, sizes); err != nil {
+			t.Fatalf("delta at %d: %v", c.Tick, err)
+		}
+		if !sameItems(s, steps[i+1]) {
+			t.Fatalf("delta at %d gives %v, want %v", c.Tick, s.Items(), steps[i+1].Items())
+		}
+	}
+	last := testSnapshot(t, gameInfo, snapshot.Item{Type: 10, ID: 0, Data: []int32{1, 0, 0, -1, 31}})
+	if !sameItems(chunks[11].Snapshot, last) {
+		t.Errorf("snapshot at 351 = %v, want %v", chunks[11].Snapshot.Items(), last.Items())
+	}
+}
+
+func TestReaderTicks(t *testing.T) {
+	for _, tt := range []struct {
+		version int
+		stream  []byte
+		want    []int
+	}{
+		// before tick compression, any step in the low six bits counts
+		{3, []byte{0x80, 0, 0, 0, 50, 0x85, 0xa0, 0xc0, 0, 0, 1, 0}, []int{50, 55, 87, 256}},
+		{4, []byte{0x80, 0, 0, 0, 50, 0xbf, 0x80, 0, 0, 0, 7}, []int{50, 113, 7}},
+		// since, only with tickCompressed, in the low five bits
+		{5, []byte{0x80, 0, 0, 0, 50, 0xa5, 0x85, 0, 0, 0, 9, 0xbf}, []int{50, 55, 9, 40}},
+		{6, []byte{0xc0, 0, 0, 0, 50, 0xa0, 0xe0}, []int{50, 50, 50}},
+	} {
+		h := testHeader
+		h.Version = tt.version
+		r, err := NewReader(bytes.NewReader(append(demoStart(h, nil, nil, testMap), tt.stream...)))
+		if err != nil {
+			t.Fatalf("version %d: %v", tt.version, err)
+		}
+		if len(r.Markers()) != 0 {
+			t.Errorf("version %d: Markers = %v", tt.version, r.Markers())
+		}
+		var got []int
+		for c, err := range r.Chunks() {
+			if err != nil {
+				t.Fatalf("version %d: %v", tt.version, err)
+			}
+			got = append(got, c.Tick)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("version %d: ticks %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestReaderInvalid(t *testing.T) {
+	start := demoStart(testHeader, nil, nil, testMap)
+	withVersion := func(v byte) []byte {
+		b := slices.Clone(start)
+		b[7] = v
+		return b
+	}
+	v3 := testHeader
+	v3.Version = 3
+	// a delta of zeros that unpacks to one int more than CSnapshot::MAX_SIZE
+	big, err := huffman.Compress(make([]byte, maxDataSize/4+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bigDelta := append(slices.Clone(start), byte(ChunkDelta)<<chunkTypeShift|chunkSize16, byte(len(big)), byte(len(big)>>8))
+	bigDelta = append(bigDelta, big...)
+	// the other data chunks are printed by go run testdata/gen.go -chunks
+	for name, tt := range map[string]struct {
+		file       []byte
+		unexpected bool
+	}{
+		"no marker":         {file: append([]byte("TWDEMX\x00"), start[7:]...)},
+		"too old":           {file: withVersion(2)},
+		"too new":           {file: withVersion(7)},
+		"short header":      {file: start[:100], unexpected: true},
+		"short markers":     {file: start[:headerSize+10], unexpected: true},
+		"short map":         {file: start[:len(start)-1], unexpected: true},
+		"short tick":        {file: append(slices.Clone(start), 0x80, 0, 0), unexpected: true},
+		"negative tick":     {file: append(slices.Clone(start), 0x80, 0xff, 0xff, 0xff, 0xfe)},
+		"step first":        {file: append(slices.Clone(start), 0xa5)},
+		"legacy step first": {file: append(demoStart(v3, nil, nil, testMap), 0x85)},
+		"short size":        {file: append(slices.Clone(start), 0x5f, 1), unexpected: true},
+		"short data":        {file: append(slices.Clone(start), 0x45, 1, 2), unexpected: true},
+		"data of type 0":    {file: append(slices.Clone(start), 0x01, 0)},
+		"bad snapshot":      {file: append(slices.Clone(start), unhex(t, "23 951437")...)}, // leInts(0, -1)
+		// a message whose packed ints end inside one
+		"bad var int":     {file: append(slices.Clone(start), unhex(t, "43 407103")...)},
+		"bad compression": {file: append(slices.Clone(start), 0x41, 0xff)},
+		"delta too large": {file: bigDelta},
+	} {
+		r, err := NewReader(bytes.NewReader(tt.file))
+		if err == nil {
+			_, err = r.Next()
+		}
+		if !errors.Is(err, ErrInvalidDemo) {
+			t.Errorf("%s: err = %v, want ErrInvalidDemo", name, err)
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) != tt.unexpected {
+			t.Errorf("%s: err = %v, io.ErrUnexpectedEOF %v", name, err, tt.unexpected)
+		}
+	}
+}
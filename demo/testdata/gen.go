@@ -0,0 +1,362 @@
+//go:build ignore
+
+// gen writes v6.demo and prints the data chunks reader_test.go and
+// writer_test.go expect, without using this module's encoders: the Huffman
+// tree, CVariableInt and the chunk, snapshot and delta layouts are ported
+// from ddnet's src/engine/shared/huffman.cpp (CHuffman::ConstructTree,
+// Setbits_r and Compress), compression.cpp (CVariableInt::Pack), demo.cpp
+// (CDemoRecorder::Start, WriteTickMarker and Write) and snapshot.cpp
+// (CSnapshot and CSnapshotDelta::CreateDelta). Only the frequency table is
+// taken from the huffman package, which has it from huffman.cpp.
+//
+// Run it from the demo directory:
+//
+//	go run testdata/gen.go          # writes testdata/v6.demo
+//	go run testdata/gen.go -chunks  # prints the chunks of the tests
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/teeworlds-go/huffman/v2"
+)
+
+// ddnet's HUFFMAN_MAX_SYMBOLS: the byte values and the EOF symbol
+const (
+	eofSymbol  = 256
+	numSymbols = eofSymbol + 1
+)
+
+type node struct {
+	bits, numBits uint32
+	leafs         [2]uint16
+}
+
+var nodes [2*numSymbols - 1]node
+
+// constructTree is CHuffman::ConstructTree, bubble sort and all: the order
+// it leaves equal frequencies in decides the codes.
+func constructTree() {
+	type constructNode struct {
+		id   uint16
+		freq uint32
+	}
+	var left []*constructNode
+	for i := range numSymbols {
+		nodes[i] = node{numBits: 0xffffffff, leafs: [2]uint16{0xffff, 0xffff}}
+		freq := uint32(1)
+		if i != eofSymbol {
+			freq = huffman.TeeworldsFrequencyTable[i]
+		}
+		left = append(left, &constructNode{id: uint16(i), freq: freq})
+	}
+	num := numSymbols
+	for n := len(left); n > 1; n-- {
+		for size, changed := n, true; changed; size-- {
+			changed = false
+			for i := 0; i < size-1; i++ {
+				if left[i].freq < left[i+1].freq {
+					left[i], left[i+1] = left[i+1], left[i]
+					changed = true
+				}
+			}
+		}
+		nodes[num] = node{leafs: [2]uint16{left[n-1].id, left[n-2].id}}
+		left[n-2].id = uint16(num)
+		left[n-2].freq += left[n-1].freq
+		num++
+	}
+	setBits(num-1, 0, 0)
+}
+
+func setBits(i int, bits, depth uint32) {
+	n := &nodes[i]
+	if n.leafs[1] != 0xffff {
+		setBits(int(n.leafs[1]), bits|1<<depth, depth+1)
+	}
+	if n.leafs[0] != 0xffff {
+		setBits(int(n.leafs[0]), bits, depth+1)
+	}
+	if n.numBits != 0 {
+		n.bits, n.numBits = bits, depth
+	}
+}
+
+// compress is CHuffman::Compress, which writes no byte after an EOF symbol
+// that ends on a byte boundary.
+func compress(data []byte) []byte {
+	var (
+		out   []byte
+		acc   uint64
+		count uint32
+	)
+	put := func(sym int) {
+		acc |= uint64(nodes[sym].bits) << count
+		count += nodes[sym].numBits
+		for ; count >= 8; count -= 8 {
+			out = append(out, byte(acc))
+			acc >>= 8
+		}
+	}
+	for _, b := range data {
+		put(int(b))
+	}
+	put(eofSymbol)
+	if count > 0 {
+		out = append(out, byte(acc))
+	}
+	return out
+}
+
+// varInt is CVariableInt::Pack.
+func varInt(i int32) []byte {
+	var b byte
+	if i < 0 {
+		b = 0x40
+		i = ^i
+	}
+	b |= byte(i & 0x3f)
+	i >>= 6
+	var out []byte
+	for i != 0 {
+		out = append(out, b|0x80)
+		b = byte(i & 0x7f)
+		i >>= 7
+	}
+	return append(out, b)
+}
+
+func ints(vs ...int32) []byte {
+	var b []byte
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint32(b, uint32(v))
+	}
+	return b
+}
+
+type item struct {
+	typ, id int32
+	data    []int32
+}
+
+// snap is a CSnapshot: data size, number of items, their offsets, then the
+// items, each its key and data.
+func snap(items ...item) []byte {
+	var offsets, data []int32
+	off := int32(0)
+	for _, it := range items {
+		offsets = append(offsets, off)
+		off += 4 + 4*int32(len(it.data))
+		data = append(append(data, it.typ<<16|it.id), it.data...)
+	}
+	return ints(slices.Concat([]int32{off, int32(len(items))}, offsets, data)...)
+}
+
+// delta is what CSnapshotDelta::CreateDelta builds: the number of deleted,
+// updated and temporary items, the keys of the deleted ones, then each
+// updated one with its size in ints unless sizes has it, and its data as the
+// difference to before.
+func delta(deleted [][2]int32, updated []item, sizes map[int32]bool) []byte {
+	d := []int32{int32(len(deleted)), int32(len(updated)), 0}
+	for _, k := range deleted {
+		d = append(d, k[0]<<16|k[1])
+	}
+	for _, it := range updated {
+		d = append(d, it.typ, it.id)
+		if !sizes[it.typ] {
+			d = append(d, int32(len(it.data)))
+		}
+		d = append(d, it.data...)
+	}
+	return ints(d...)
+}
+
+func diff(from, to []int32) []int32 {
+	d := make([]int32, len(to))
+	for i := range to {
+		d[i] = to[i] - from[i]
+	}
+	return d
+}
+
+// chunk is CDemoRecorder::Write: data padded to whole ints, packed with
+// CVariableInt and Huffman compressed, behind the chunk type and size.
+func chunk(typ byte, data []byte) []byte {
+	data = append(slices.Clone(data), make([]byte, -len(data)&3)...)
+	var packed []byte
+	for i := 0; i < len(data); i += 4 {
+		packed = append(packed, varInt(int32(binary.LittleEndian.Uint32(data[i:])))...)
+	}
+	c := compress(packed)
+	n := len(c)
+	head := typ << 5
+	switch {
+	case n < 30:
+		return append([]byte{head | byte(n)}, c...)
+	case n <= 0xff:
+		return append([]byte{head | 30, byte(n)}, c...)
+	}
+	return append([]byte{head | 31, byte(n), byte(n >> 8)}, c...)
+}
+
+const (
+	chunkSnapshot = 1
+	chunkMessage  = 2
+	chunkDelta    = 3
+)
+
+// tickFull and tickStep are the tick markers of CDemoRecorder::WriteTickMarker
+// from version 5 on.
+func tickFull(tick int32, keyframe bool) []byte {
+	b := byte(0x80)
+	if keyframe {
+		b |= 0x40
+	}
+	return binary.BigEndian.AppendUint32([]byte{b}, uint32(tick))
+}
+
+func tickStep(step byte) []byte {
+	return []byte{0x80 | 0x20 | step}
+}
+
+func field(s string, n int) []byte {
+	b := make([]byte, n)
+	copy(b[:n-1], s)
+	return b
+}
+
+// sizes06 are the item types of 0.6 whose size a delta leaves out.
+var sizes06 = map[int32]bool{}
+
+func init() {
+	for typ := int32(1); typ <= 20; typ++ {
+		sizes06[typ] = true
+	}
+}
+
+func v6Demo() []byte {
+	mapData := append([]byte("DATA"), make([]byte, 60)...)
+	for i := range 60 {
+		mapData[4+i] = byte(i)
+	}
+
+	gameInfo := item{6, 0, []int32{0, 0, 100, 0, 20, 0, 0, 0}}
+	character := item{9, 0, []int32{100, 1024, 576, 0, 128, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 0, 10, 1, 0, 0}}
+	playerInfo := item{10, 0, []int32{1, 0, 0, 0, 25}}
+	character2 := item{9, 0, []int32{101, 1030, 580, 256, 192, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 10, 0, 10, 1, 0, 0}}
+	playerInfo2 := item{10, 0, []int32{1, 0, 0, 0, 27}}
+	playerInfo3 := item{10, 0, []int32{1, 0, 0, -1, 27}}
+	death := item{17, 0, []int32{1040, 600, 0}}
+
+	// NETMSGTYPE_SV_CHAT of 0.6: team 0, client -1, a message; the
+	// second takes the one-byte form of the chunk size. NETMSGTYPE_SV_MOTD
+	// takes the two-byte one.
+	chat := slices.Concat(varInt(3<<1), varInt(0), varInt(-1), []byte("hello\x00"))
+	medium := slices.Concat(varInt(3<<1), varInt(0), varInt(-1), []byte("the quick brown fox jumps over the lazy dog\x00"))
+	motd := slices.Concat(varInt(1<<1), []byte(strings.Repeat("welcome to the server, have fun and play fair. ", 8)+"\x00"))
+
+	stream := slices.Concat(
+		tickFull(100, true),
+		chunk(chunkSnapshot, snap(gameInfo, character, playerInfo)),
+		chunk(chunkMessage, chat),
+		tickStep(1),
+		chunk(chunkDelta, delta(nil, []item{
+			{9, 0, diff(character.data, character2.data)},
+			{10, 0, diff(playerInfo.data, playerInfo2.data)},
+		}, sizes06)),
+		tickStep(1), // nothing changed, no delta
+		chunk(chunkMessage, medium),
+		chunk(chunkMessage, motd),
+		tickFull(140, false),
+		chunk(chunkDelta, delta([][2]int32{{9, 0}}, []item{
+			{10, 0, diff(playerInfo2.data, playerInfo3.data)},
+			death,
+		}, sizes06)),
+		tickFull(351, true),
+		chunk(chunkSnapshot, snap(gameInfo, item{10, 0, []int32{1, 0, 0, -1, 31}})),
+	)
+
+	// CDemoRecorder::Start: header, timeline markers, the SHA256 extension
+	// UUID and the map's SHA256, then the map
+	header := slices.Concat(
+		[]byte("TWDEMO\x00"), []byte{6},
+		field("0.6 626fce9a778df4d4", 64), field("ctf1", 64),
+		binary.BigEndian.AppendUint32(nil, uint32(len(mapData))),
+		binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(mapData)),
+		field("client", 8),
+		binary.BigEndian.AppendUint32(nil, (351-100)/50),
+		field("2026-10-19_12-00-00", 20),
+	)
+	markers := slices.Concat(binary.BigEndian.AppendUint32(nil, 1), binary.BigEndian.AppendUint32(nil, 120), make([]byte, 4*63))
+	ext, _ := hex.DecodeString("6be6da4acebd380c9b5b1289c842d780")
+	sum := sha256.Sum256(mapData)
+	return slices.Concat(header, markers, ext, sum[:], mapData, stream)
+}
+
+func printChunks() {
+	show := func(name string, c []byte) {
+		s := hex.EncodeToString(c)
+		// the head byte stands apart, and so do the size bytes after it
+		n := 1
+		switch c[0] & 0x1f {
+		case 30:
+			n = 2
+		case 31:
+			n = 3
+		}
+		fmt.Printf("%-24s %s %s\n", name, s[:2], strings.TrimSpace(s[2:2*n]+" "+s[2*n:]))
+	}
+
+	// TestReader
+	first := []item{{1, 0, []int32{1, 2}}, {2, 3, []int32{5}}}
+	show("reader first", chunk(chunkSnapshot, snap(first...)))
+	show("reader delta", chunk(chunkDelta, delta([][2]int32{{2, 3}}, []item{{1, 0, []int32{0, 5}}, {4, 1, []int32{-9, 0, 9}}}, nil)))
+	show("reader message", chunk(chunkMessage, []byte("\x06hello\x00")))
+	show("reader medium", chunk(chunkMessage, []byte("\x06\x00\x40the quick brown fox jumps over the lazy dog\x00")))
+
+	// TestReaderInvalid
+	show("invalid bad snapshot", chunk(chunkSnapshot, ints(0, -1)))
+	bad := compress([]byte{0x80})
+	show("invalid bad var int", append([]byte{chunkMessage<<5 | byte(len(bad))}, bad...))
+
+	// TestWriter, whose item type 1 has its size known
+	sizes := map[int32]bool{1: true}
+	show("writer s100", chunk(chunkSnapshot, snap(first...)))
+	show("writer message", chunk(chunkMessage, []byte("\x06hi\x00")))
+	show("writer delta to s101", chunk(chunkDelta, delta([][2]int32{{2, 3}}, []item{{1, 0, []int32{0, 5}}, {4, 1, []int32{-9, 0, 9}}}, sizes)))
+	show("writer s400", chunk(chunkSnapshot, snap(item{1, 0, []int32{3, 7}}, item{4, 1, []int32{-9, 0, 9}})))
+	show("writer s401", chunk(chunkSnapshot, snap(item{1, 0, []int32{3, 7}}, item{4, 1, []int32{-9, 0}})))
+	show("writer delta to s500", chunk(chunkDelta, delta([][2]int32{{1, 0}}, []item{{4, 1, []int32{0, 1}}}, sizes)))
+}
+
+func main() {
+	chunks := flag.Bool("chunks", false, "print the chunks of the tests instead of writing v6.demo")
+	flag.Parse()
+
+	constructTree()
+	// ddnet TEST(Huffman, CompressionInputSizeZero) and TEST(Huffman, CompressionCompatible)
+	if got := hex.EncodeToString(compress(nil)); got != "8a1b" {
+		log.Fatalf("empty stream %s, want 8a1b", got)
+	}
+	in := append([]byte{0, 1, 2, 3, 4, 5, 6, 7}, make([]byte, 56)...)
+	if got := hex.EncodeToString(compress(in)); got != "515878761bb7ffffffffffff7fc50d" {
+		log.Fatalf("compatible stream %s", got)
+	}
+
+	if *chunks {
+		printChunks()
+		return
+	}
+	if err := os.WriteFile("testdata/v6.demo", v6Demo(), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,369 @@
+package demo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/teeworlds-go/huffman/v2"
+	"github.com/teeworlds-go/huffman/v2/snapshot"
+)
+
+const (
+	// tickSpeed is SERVER_TICK_SPEED, the ticks in a second.
+	tickSpeed = 50
+	// keyframeInterval is how many ticks WriteSnapshot writes deltas for
+	// before the next whole snapshot, as CDemoRecorder::RecordSnapshot does.
+	keyframeInterval = 5 * tickSpeed
+
+	// lengthOffset is where the length sits in the header.
+	lengthOffset = 152
+	// maxChunkSize is the largest compressed chunk the size of a data chunk
+	// can express.
+	maxChunkSize = 0xffff
+
+	timestampLayout = "2006-01-02_15-04-05"
+)
+
+// Writer writes a demo file the way ddnet's CDemoRecorder does, so that the
+// teeworlds and ddnet players of its version read it. NewWriter writes
+// everything in front of the chunk stream, the Write methods append chunks and
+// Close completes the header with the length and the timeline markers.
+//
+// After a failed write every method returns its error again, as the file is
+// broken from there on. Other errors leave the file as it was.
+type Writer struct {
+	w       io.WriteSeeker
+	start   int64
+	version int
+	sizes   snapshot.ItemSizes
+	markers []int
+	err     error
+
+	firstTick    int
+	lastTick     int
+	lastKeyframe int
+	// last is the snapshot WriteSnapshot makes the next delta against, nil
+	// if the next snapshot must be whole.
+	last *snapshot.Snapshot
+
+	// buffers reused from chunk to chunk, compressed filled by huff
+	snap       []byte
+	ints       []byte
+	packed     []byte
+	chunk      []byte
+	compressed bytes.Buffer
+	huff       *huffman.Writer
+}
+
+// NewWriter writes the start of a demo with header h and the map file mapData
+// to w, which stays where the demo starts until Close. sizes are the item
+// sizes the deltas of WriteSnapshot leave out; they must be those of the
+// player, such as snapshot.DDNet().ItemSizes() for ddnet.
+//
+// A zero h.Version writes version 6, the current version of ddnet. MapSize
+// and, if there is a map, MapCrc are taken from mapData, and version 6 demos
+// get its SHA256 as well. Length is filled in by Close, an empty Timestamp
+// with the current time. Strings are cut to fit their field.
+func NewWriter(w io.WriteSeeker, h Header, mapData []byte, sizes snapshot.ItemSizes) (*Writer, error) {
+	if h.Version == 0 {
+		h.Version = versionSHA256
+	}
+	if h.Version < versionOld || h.Version > versionSHA256 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidDemo, h.Version)
+	}
+	if h.Timestamp == "" {
+		h.Timestamp = time.Now().Format(timestampLayout)
+	}
+	h.MapSize = len(mapData)
+	if len(mapData) > 0 {
+		h.MapCrc = crc32.ChecksumIEEE(mapData)
+	}
+	h.Length = 0
+
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	dw := &Writer{
+		w:            w,
+		start:        start,
+		version:      h.Version,
+		sizes:        sizes,
+		firstTick:    -1,
+		lastTick:     -1,
+		lastKeyframe: -1,
+	}
+	dw.huff = huffman.NewWriter(&dw.compressed)
+
+	b := append(headerMarker[:len(headerMarker):len(headerMarker)], byte(h.Version))
+	b = appendField(b, h.NetVersion, 64)
+	b = appendField(b, h.MapName, 64)
+	b = binary.BigEndian.AppendUint32(b, uint32(h.MapSize))
+	b = binary.BigEndian.AppendUint32(b, h.MapCrc)
+	b = appendField(b, h.Type, 8)
+	b = binary.BigEndian.AppendUint32(b, uint32(h.Length))
+	b = appendField(b, h.Timestamp, 20)
+	if h.Version >= versionMarkers {
+		// filled in by Close
+		b = append(b, make([]byte, markersSize)...)
+	}
+	if h.Version >= versionSHA256 && len(mapData) > 0 {
+		sum := sha256.Sum256(mapData)
+		b = append(b, sha256Extension[:]...)
+		b = append(b, sum[:]...)
+	}
+	if err := dw.write(b); err != nil {
+		return nil, err
+	}
+	if err := dw.write(mapData); err != nil {
+		return nil, err
+	}
+	return dw, nil
+}
+
+// AddMarker adds a timeline marker at tick, up to MaxTimelineMarkers.
+func (w *Writer) AddMarker(tick int) error {
+	if w.version < versionMarkers {
+		return fmt.Errorf("%w: version %d has no timeline markers", ErrInvalidDemo, w.version)
+	}
+	if len(w.markers) >= MaxTimelineMarkers {
+		return fmt.Errorf("%w: more than %d timeline markers", ErrInvalidDemo, MaxTimelineMarkers)
+	}
+	w.markers = append(w.markers, tick)
+	return nil
+}
+
+// WriteSnapshot writes the snapshot s of tick the way
+// CDemoRecorder::RecordSnapshot does: a tick marker, then s as a whole at a
+// keyframe, otherwise as the delta to the snapshot before, which is left out
+// if nothing changed. A keyframe comes first and then every five seconds, and
+// whenever an item changes its size. s must not be modified afterwards.
+func (w *Writer) WriteSnapshot(tick int, s *snapshot.Snapshot) error {
+	if w.err != nil {
+		return w.err
+	}
+	var delta []byte
+	keyframe := w.last == nil || tick-w.lastKeyframe > keyframeInterval
+	if !keyframe {
+		var err error
+		delta, err = snapshot.PackDelta(w.packed[:0], w.last, s, w.sizes)
+		keyframe = err != nil
+	}
+	if err := w.WriteTick(tick, keyframe); err != nil {
+		return err
+	}
+	if keyframe {
+		return w.writeSnapshot(s)
+	}
+	if len(delta) == 0 {
+		return nil
+	}
+	w.packed = delta
+	if err := w.writeData(ChunkDelta, delta); err != nil {
+		return err
+	}
+	w.last = s
+	return nil
+}
+
+// WriteMessage writes the net message data, header first, at the tick of the
+// last tick marker.
+func (w *Writer) WriteMessage(data []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.writeUnpacked(ChunkMessage, data)
+}
+
+// WriteTick writes a tick marker that starts tick, a keyframe if set. Small
+// steps from the tick before are stored in the marker itself.
+func (w *Writer) WriteTick(tick int, keyframe bool) error {
+	if w.err != nil {
+		return w.err
+	}
+	if tick < 0 {
+		return fmt.Errorf("%w: negative tick %d", ErrInvalidDemo, tick)
+	}
+	step := tick - w.lastTick
+	b := w.chunk[:0]
+	switch {
+	case keyframe || w.lastTick < 0:
+		b = append(b, chunkTickMarker)
+		if keyframe {
+			b[0] |= tickKeyframe
+		}
+		b = binary.BigEndian.AppendUint32(b, uint32(tick))
+	case w.version >= versionTickCompression && step >= 0 && step <= tickMask:
+		b = append(b, chunkTickMarker|tickCompressed|byte(step))
+	case w.version < versionTickCompression && step > 0 && step <= tickMaskLegacy:
+		b = append(b, chunkTickMarker|byte(step))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, chunkTickMarker), uint32(tick))
+	}
+	w.chunk = b
+	if err := w.write(b); err != nil {
+		return err
+	}
+	if w.firstTick < 0 {
+		w.firstTick = tick
+	}
+	w.lastTick = tick
+	return nil
+}
+
+// WriteChunk writes c as it is, to copy the chunks of one demo into another,
+// see Reader.Next. A snapshot chunk needs c.Snapshot, which becomes the base of
+// the next delta of WriteSnapshot. After a delta chunk WriteSnapshot starts
+// with a keyframe, as it does not know the snapshot the delta leads to.
+func (w *Writer) WriteChunk(c Chunk) error {
+	if w.err != nil {
+		return w.err
+	}
+	switch c.Type {
+	case ChunkTick:
+		return w.WriteTick(c.Tick, c.Keyframe)
+	case ChunkSnapshot:
+		if c.Snapshot == nil {
+			return fmt.Errorf("%w: snapshot chunk without a snapshot", ErrInvalidDemo)
+		}
+		return w.writeSnapshot(c.Snapshot)
+	case ChunkMessage:
+		return w.writeUnpacked(ChunkMessage, c.Data)
+	case ChunkDelta:
+		w.last = nil
+		return w.writeDelta(c.Data)
+	}
+	return fmt.Errorf("%w: unknown chunk type %s", ErrInvalidDemo, c.Type)
+}
+
+// Close completes the header with the length of the demo, in whole seconds
+// from the first to the last tick marker, and the timeline markers, as
+// CDemoRecorder::Stop does. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	length := 0
+	if w.firstTick >= 0 {
+		length = (w.lastTick - w.firstTick) / tickSpeed
+	}
+	if err := w.writeAt(lengthOffset, binary.BigEndian.AppendUint32(nil, uint32(length))); err != nil {
+		return err
+	}
+	if w.version >= versionMarkers {
+		b := binary.BigEndian.AppendUint32(nil, uint32(len(w.markers)))
+		for _, tick := range w.markers {
+			b = binary.BigEndian.AppendUint32(b, uint32(tick))
+		}
+		if err := w.writeAt(headerSize, b); err != nil {
+			return err
+		}
+	}
+	if _, err := w.w.Seek(0, io.SeekEnd); err != nil {
+		w.err = err
+		return err
+	}
+	w.err = fmt.Errorf("%w: writer is closed", ErrInvalidDemo)
+	return nil
+}
+
+func (w *Writer) writeSnapshot(s *snapshot.Snapshot) error {
+	w.snap, _ = s.AppendBinary(w.snap[:0])
+	if err := w.writeUnpacked(ChunkSnapshot, w.snap); err != nil {
+		return err
+	}
+	w.last = s
+	w.lastKeyframe = w.lastTick
+	return nil
+}
+
+// writeUnpacked writes data as a chunk of typ, padded with zeros to whole ints
+// and packed with CVariableInt first.
+func (w *Writer) writeUnpacked(typ ChunkType, data []byte) error {
+	w.ints = append(w.ints[:0], data...)
+	for len(w.ints)%4 != 0 {
+		w.ints = append(w.ints, 0)
+	}
+	if len(w.ints) > maxDataSize {
+		return fmt.Errorf("%w: %s of %d bytes exceeds the maximum of %d", ErrInvalidDemo, typ, len(data), maxDataSize)
+	}
+	w.packed, _ = huffman.CompressVarInt(w.packed[:0], w.ints)
+	return w.writeData(typ, w.packed)
+}
+
+// writeDelta writes the packed delta data, which must not unpack to more than
+// CDemoPlayer reads.
+func (w *Writer) writeDelta(data []byte) error {
+	ints, err := huffman.DecompressVarInt(w.ints[:0], data)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidDemo, ChunkDelta, err)
+	}
+	w.ints = ints
+	if len(ints) > maxDataSize {
+		return fmt.Errorf("%w: %s unpacks to %d bytes, more than %d", ErrInvalidDemo, ChunkDelta, len(ints), maxDataSize)
+	}
+	return w.writeData(ChunkDelta, data)
+}
+
+// writeData Huffman compresses the packed data and writes it as a chunk of
+// typ, the way CDemoRecorder::Write does.
+func (w *Writer) writeData(typ ChunkType, packed []byte) error {
+	w.compressed.Reset()
+	if _, err := w.huff.Write(packed); err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrInvalidDemo, typ, err)
+	}
+	compressed := w.compressed.Bytes()
+	n := len(compressed)
+	if n > maxChunkSize {
+		return fmt.Errorf("%w: %s compresses to %d bytes, more than %d", ErrInvalidDemo, typ, n, maxChunkSize)
+	}
+
+	head := byte(typ) << chunkTypeShift
+	b := w.chunk[:0]
+	switch {
+	case n < chunkSize8:
+		b = append(b, head|byte(n))
+	case n <= 0xff:
+		b = append(b, head|chunkSize8, byte(n))
+	default:
+		b = append(b, head|chunkSize16, byte(n), byte(n>>8))
+	}
+	w.chunk = append(b, compressed...)
+	return w.write(w.chunk)
+}
+
+func (w *Writer) write(b []byte) error {
+	if _, err := w.w.Write(b); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+func (w *Writer) writeAt(offset int64, b []byte) error {
+	if _, err := w.w.Seek(w.start+offset, io.SeekStart); err != nil {
+		w.err = err
+		return err
+	}
+	return w.write(b)
+}
+
+// appendField appends s as a zero-terminated string in a field of n bytes,
+// cut to fit at a rune boundary like str_copy does.
+func appendField(b []byte, s string, n int) []byte {
+	if len(s) > n-1 {
+		cut := n - 1
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = s[:cut]
+	}
+	b = append(b, s...)
+	return append(b, make([]byte, n-len(s))...)
+}
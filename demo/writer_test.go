@@ -0,0 +1,425 @@
+package demo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/teeworlds-go/huffman/v2/snapshot"
+)
+
+func tempFile(t *testing.T) *os.File {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "*.demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func contents(t *testing.T, f *os.File) []byte {
+	t.Helper()
+	b, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func checkBytes(t *testing.T, got, want []byte) {
+	t.Helper()
+	if bytes.Equal(got, want) {
+		return
+	}
+	i := 0
+	for i < len(got) && i < len(want) && got[i] == want[i] {
+		i++
+	}
+	t.Fatalf("got %d bytes, want %d, first difference at offset %d:\ngot  %x\nwant %x",
+		len(got), len(want), i, got[i:min(len(got), i+16)], want[i:min(len(want), i+16)])
+}
+
+// The writer lays out a demo byte for byte as CDemoRecorder does: keyframes
+// every five seconds and on a resized item, deltas in between, left out when
+// nothing changed, and small tick steps in the tick markers.
+func TestWriter(t *testing.T) {
+	sizes := snapshot.ItemSizes{1: 2}
+	s100 := testSnapshot(t,
+		snapshot.Item{Type: 1, ID: 0, Data: []int32{1, 2}},
+		snapshot.Item{Type: 2, ID: 3, Data: []int32{5}},
+	)
+	s101 := testSnapshot(t,
+		snapshot.Item{Type: 1, ID: 0, Data: []int32{1, 7}},
+		snapshot.Item{Type: 4, ID: 1, Data: []int32{-9, 0, 9}},
+	)
+	s400 := testSnapshot(t,
+		snapshot.Item{Type: 1, ID: 0, Data: []int32{3, 7}},
+		snapshot.Item{Type: 4, ID: 1, Data: []int32{-9, 0, 9}},
+	)
+	s401 := testSnapshot(t,
+		snapshot.Item{Type: 1, ID: 0, Data: []int32{3, 7}},
+		snapshot.Item{Type: 4, ID: 1, Data: []int32{-9, 0}},
+	)
+	s500 := testSnapshot(t,
+		snapshot.Item{Type: 4, ID: 1, Data: []int32{-9, 1}},
+	)
+	message := []byte{0x06, 'h', 'i', 0}
+
+	f := tempFile(t)
+	w, err := NewWriter(f, testHeader, testMap, sizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		w.WriteSnapshot(100, s100),
+		w.WriteMessage(message),
+		w.WriteSnapshot(101, s101),
+		w.WriteSnapshot(102, s101),
+		w.AddMarker(150),
+		w.WriteSnapshot(400, s400),
+		w.WriteSnapshot(401, s401),
+		w.AddMarker(450),
+		w.WriteSnapshot(500, s500),
+		w.Close(),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := testHeader
+	h.MapCrc = crc32.ChecksumIEEE(testMap)
+	h.Length = (500 - 100) / 50
+	sum := sha256.Sum256(testMap)
+	want := demoStart(h, []int{150, 450}, sum[:], testMap)
+	// the data chunks as CDemoRecorder::Write builds them, see TestReader
+	want = append(want, 0xc0, 0, 0, 0, 100)
+	want = append(want, unhex(t, "2c f0a21c0082c26f406d57dc00")...)
+	want = append(want, unhex(t, "47 52f841998de206")...)
+	want = append(want, 0xa1)
+	// 1 deleted, 2 updated, 0 temporary items: 2:3 gone, 1:0 by 0, 5 without
+	// its size, 4:1 new with it
+	want = append(want, unhex(t, "6d 28fa0da871bb87167c652a6e00")...)
+	want = append(want, 0xa1)
+	want = append(want, 0xc0, 0, 0, 1, 0x90)
+	want = append(want, unhex(t, "2e 0a443900c4c2cd4fc09aaf4cc50d")...)
+	want = append(want, 0xc0, 0, 0, 1, 0x91)
+	want = append(want, unhex(t, "2d 10510e00b170f313b0e6abe206")...)
+	want = append(want, 0x80, 0, 0, 1, 0xf4)
+	// 1:0 gone, 4:1 by 0, 1 with its size
+	want = append(want, unhex(t, "68 8801201e8aa8b801")...)
+	checkBytes(t, contents(t, f), want)
+}
+
+// A demo copied chunk by chunk comes out as it went in, wherever in the file
+// it starts.
+func TestWriterCopy(t *testing.T) {
+	src := tempFile(t)
+	w, err := NewWriter(src, testHeader, testMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &snapshot.Snapshot{}
+	tick := 1000
+	for i := range 700 {
+		next := testSnapshot(t,
+			snapshot.Item{Type: 1, ID: 0, Data: []int32{int32(i), 2}},
+			snapshot.Item{Type: 2, ID: i % 3, Data: []int32{int32(i / 7)}},
+		)
+		// steps that fit the tick markers and steps that do not
+		tick += 1 + i%40
+		if err := w.WriteSnapshot(tick, next); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteMessage(bytes.Repeat([]byte{byte(i)}, i%50)); err != nil {
+			t.Fatal(err)
+		}
+		s = next
+	}
+	if err := w.AddMarker(1234); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := contents(t, src)
+
+	r, err := NewReader(bytes.NewReader(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := tempFile(t)
+	if _, err := dst.WriteString("junk"); err != nil {
+		t.Fatal(err)
+	}
+	cw, err := NewWriter(dst, r.Header(), r.Map(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tick := range r.Markers() {
+		if err := cw.AddMarker(tick); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var last *snapshot.Snapshot
+	for c, err := range r.Chunks() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Type == ChunkDelta {
+			if last, err = snapshot.UnpackDelta(last, c.Data, nil); err != nil {
+				t.Fatal(err)
+			}
+		} else if c.Type == ChunkSnapshot {
+			last = c.Snapshot
+		}
+		if err := cw.WriteChunk(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !sameItems(last, s) {
+		t.Errorf("last snapshot %v, want %v", last.Items(), s.Items())
+	}
+	got := contents(t, dst)
+	if !bytes.HasPrefix(got, []byte("junk")) {
+		t.Fatalf("copy overwrote what came before it")
+	}
+	checkBytes(t, got[4:], want)
+}
+
+// testdata/v6.demo comes out byte for byte, both copied chunk by chunk and
+// recorded anew from its snapshots and messages, see TestReaderTestdata.
+func TestWriterTestdata(t *testing.T) {
+	want, err := os.ReadFile("testdata/v6.demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chunks []Chunk
+	for c, err := range r.Chunks() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Data = slices.Clone(c.Data)
+		chunks = append(chunks, c)
+	}
+
+	sizes := snapshot.Vanilla06().ItemSizes()
+	for _, record := range []bool{false, true} {
+		f := tempFile(t)
+		w, err := NewWriter(f, r.Header(), r.Map(), sizes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tick := range r.Markers() {
+			if err := w.AddMarker(tick); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var last *snapshot.Snapshot
+		for i, c := range chunks {
+			switch {
+			case !record:
+				err = w.WriteChunk(c)
+			case c.Type == ChunkTick:
+				// the snapshot or delta after the marker gives the snapshot
+				// of the tick, without either it is unchanged
+				if i+1 < len(chunks) && chunks[i+1].Type == ChunkSnapshot {
+					last = chunks[i+1].Snapshot
+				} else if i+1 < len(chunks) && chunks[i+1].Type == ChunkDelta {
+					last, err = snapshot.UnpackDelta(last, chunks[i+1].Data, sizes)
+				}
+				if err == nil {
+					err = w.WriteSnapshot(c.Tick, last)
+				}
+			case c.Type == ChunkMessage:
+				err = w.WriteMessage(c.Data)
+			}
+			if err != nil {
+				t.Fatalf("record %v, chunk %d: %v", record, i, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		checkBytes(t, contents(t, f), want)
+	}
+}
+
+// Chunks are packed and compressed into buffers the Writer keeps.
+func TestWriterAllocs(t *testing.T) {
+	w, err := NewWriter(tempFile(t), testHeader, testMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := bytes.Repeat([]byte("chat "), 100)
+	delta := Chunk{Type: ChunkDelta, Data: []byte{0, 1, 0, 1, 0, 1, 5}}
+	allocs := testing.AllocsPerRun(10, func() {
+		if err := w.WriteMessage(message); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteChunk(delta); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("writing a message and a delta allocated %.0f times", allocs)
+	}
+}
+
+func TestWriterTicks(t *testing.T) {
+	ticks := []int{50, 55, 55, 87, 200, 231}
+	for _, tt := range []struct {
+		version int
+		want    []byte
+	}{
+		{3, []byte{0x80, 0, 0, 0, 50, 0x85, 0x80, 0, 0, 0, 55, 0xa0, 0x80, 0, 0, 0, 200, 0x9f}},
+		{4, []byte{0x80, 0, 0, 0, 50, 0x85, 0x80, 0, 0, 0, 55, 0xa0, 0x80, 0, 0, 0, 200, 0x9f}},
+		{5, []byte{0x80, 0, 0, 0, 50, 0xa5, 0xa0, 0x80, 0, 0, 0, 87, 0x80, 0, 0, 0, 200, 0xbf}},
+		{6, []byte{0x80, 0, 0, 0, 50, 0xa5, 0xa0, 0x80, 0, 0, 0, 87, 0x80, 0, 0, 0, 200, 0xbf}},
+	} {
+		h := testHeader
+		h.Version = tt.version
+		f := tempFile(t)
+		w, err := NewWriter(f, h, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tick := range ticks {
+			if err := w.WriteTick(tick, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		file := contents(t, f)
+		h.MapSize, h.MapCrc, h.Length = 0, testHeader.MapCrc, (231-50)/50
+		checkBytes(t, file, append(demoStart(h, nil, nil, nil), tt.want...))
+
+		r, err := NewReader(bytes.NewReader(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for c, err := range r.Chunks() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, c.Tick)
+		}
+		if !slices.Equal(got, ticks) {
+			t.Errorf("version %d: read ticks %v, want %v", tt.version, got, ticks)
+		}
+	}
+}
+
+func TestWriterHeader(t *testing.T) {
+	h := testHeader
+	h.Version = 0
+	h.MapName = strings.Repeat("x", 62) + "ä"
+	h.Timestamp = ""
+	f := tempFile(t)
+	w, err := NewWriter(f, h, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(contents(t, f)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := r.Header()
+	if got.Version != 6 || got.MapName != strings.Repeat("x", 62) || len(got.Timestamp) != len(timestampLayout) {
+		t.Errorf("Header = %+v", got)
+	}
+	if _, ok := r.MapSHA256(); ok {
+		t.Errorf("map SHA256 without a map")
+	}
+}
+
+func TestWriterInvalid(t *testing.T) {
+	h := testHeader
+	h.Version = 7
+	if _, err := NewWriter(tempFile(t), h, nil, nil); !errors.Is(err, ErrInvalidDemo) {
+		t.Errorf("version 7: err = %v, want ErrInvalidDemo", err)
+	}
+
+	h.Version = 3
+	old, err := NewWriter(tempFile(t), h, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.AddMarker(1); !errors.Is(err, ErrInvalidDemo) {
+		t.Errorf("marker in version 3: err = %v, want ErrInvalidDemo", err)
+	}
+
+	f := tempFile(t)
+	w, err := NewWriter(f, testHeader, testMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range MaxTimelineMarkers {
+		if err := w.AddMarker(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, err := range map[string]error{
+		"too many markers":  w.AddMarker(100),
+		"negative tick":     w.WriteTick(-1, false),
+		"message too large": w.WriteMessage(make([]byte, maxDataSize+1)),
+		"delta too large":   w.WriteChunk(Chunk{Type: ChunkDelta, Data: make([]byte, maxDataSize/4+1)}),
+		"bad delta":         w.WriteChunk(Chunk{Type: ChunkDelta, Data: []byte{0x80}}),
+		"no snapshot":       w.WriteChunk(Chunk{Type: ChunkSnapshot}),
+		"unknown chunk":     w.WriteChunk(Chunk{Type: 7}),
+	} {
+		if !errors.Is(err, ErrInvalidDemo) {
+			t.Errorf("%s: err = %v, want ErrInvalidDemo", name, err)
+		}
+	}
+	if err := w.WriteTick(5, true); err != nil {
+		t.Fatalf("errors broke the writer: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteTick(6, false); err == nil {
+		t.Errorf("WriteTick after Close succeeded")
+	}
+
+	// a failed write sticks
+	f = tempFile(t)
+	w, err = NewWriter(f, testHeader, testMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	first := w.WriteTick(1, true)
+	if first == nil || !errors.Is(w.WriteMessage(nil), first) || !errors.Is(w.Close(), first) {
+		t.Errorf("write to a closed file: err = %v, not kept", first)
+	}
+
+	r, err := NewReader(bytes.NewReader(contents(t, f)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("failed writes left chunks: err = %v", err)
+	}
+}
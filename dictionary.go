@@ -1,6 +1,9 @@
 package huffman
 
-import "sort"
+import (
+	"fmt"
+	"sort"
+)
 
 const (
 	maxNodes          = (MaxSymbols)*2 + 1 // +1 for additional EOF symbol
@@ -120,6 +123,20 @@ func (d *Dictionary) isInitialized() bool {
 	return d != nil && d.numNodes == maxNodes && d.maxCodeLen != 0
 }
 
+// usable returns why d cannot be used for coding, as an error wrapping kind,
+// which is ErrHuffmanCompress or ErrHuffmanDecompress. It is nil if d can.
+// Codes are stored as uint32, so deeper custom trees are rejected instead of
+// having their codes truncated into a corrupt stream.
+func (d *Dictionary) usable(kind error) error {
+	if !d.isInitialized() {
+		return fmt.Errorf("%w: dictionary is nil or uninitialized", kind)
+	}
+	if d.maxCodeLen > maxStoredCodeBits {
+		return fmt.Errorf("%w: dictionary contains %d-bit codes, maximum supported is %d", kind, d.maxCodeLen, maxStoredCodeBits)
+	}
+	return nil
+}
+
 func NewDictionaryWithFrequencies(frequencyTable [MaxSymbols]uint32) *Dictionary {
 
 	d := Dictionary{}
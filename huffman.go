@@ -3,6 +3,7 @@ package huffman
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
 )
 
 const (
@@ -51,18 +52,53 @@ func DecompressDict(dict *Dictionary, data []byte) ([]byte, error) {
 
 type Huffman struct {
 	*Dictionary
+
+	// Strict makes the decoder reject streams whose padding bits after the
+	// EOF symbol are not zero, or that are followed by further data. The one
+	// zero byte teeworlds 0.7 appends after a byte-aligned EOF symbol is
+	// still accepted. Off by default, matching the reference decoders, which
+	// ignore everything after the EOF symbol.
+	Strict bool
+
+	// LegacyPadding makes the encoder reproduce teeworlds 0.7 byte for byte:
+	// it always writes the final partial byte, even when the EOF symbol ends
+	// on a byte boundary and that byte is zero. Off by default, which follows
+	// ddnet and omits it. Decoders accept either form.
+	LegacyPadding bool
+
+	// OutputLimit caps the output of a single call at that many bytes, see
+	// WithOutputLimit. Zero or less means no limit.
+	OutputLimit int64
 }
 
-// NewHuffman creates a new Huffman instance with the default dictionary.
-func NewHuffman() *Huffman {
-	return NewHuffmanDict(DefaultDictionary)
+// NewHuffman creates a new Huffman instance configured by opts, with the
+// default dictionary unless WithDictionary is given.
+func NewHuffman(opts ...Option) *Huffman {
+	o := newOptions(opts)
+	return &Huffman{
+		Dictionary:    o.dict,
+		Strict:        o.strict,
+		LegacyPadding: o.legacyPadding,
+		OutputLimit:   o.outputLimit,
+	}
 }
 
 // NewHuffmanDict creates a new Huffman instance with the given dictionary.
 func NewHuffmanDict(d *Dictionary) *Huffman {
-	return &Huffman{
-		Dictionary: d,
+	return NewHuffman(WithDictionary(d))
+}
+
+// dictionary returns the Dictionary of huff, or why it cannot be used for
+// coding, see Dictionary.usable.
+func (huff *Huffman) dictionary(kind error) (*Dictionary, error) {
+	var d *Dictionary
+	if huff != nil {
+		d = huff.Dictionary
 	}
+	if err := d.usable(kind); err != nil {
+		return nil, err
+	}
+	return d, nil
 }
 
 // Decompress decompresses the given data.
@@ -71,8 +107,8 @@ func NewHuffmanDict(d *Dictionary) *Huffman {
 // consumes more bits than the input actually contains, so a stream that does
 // not carry an EOF symbol returns an error instead of looping forever.
 func (huff *Huffman) Decompress(data []byte) ([]byte, error) {
-	if huff == nil || !huff.Dictionary.isInitialized() {
-		return nil, fmt.Errorf("%w: dictionary is nil or uninitialized", ErrHuffmanDecompress)
+	if _, err := huff.dictionary(ErrHuffmanDecompress); err != nil {
+		return nil, err
 	}
 	if len(data) == 0 {
 		return []byte{}, nil
@@ -87,17 +123,85 @@ func (huff *Huffman) Decompress(data []byte) ([]byte, error) {
 // be nil, but dst and data must not share backing storage; passing overlapping
 // slices is invalid use. huff is not modified, so a single Huffman value is
 // safe for concurrent DecompressTo calls with distinct dst buffers.
+//
+// With Strict set, non-zero padding bits or data after the EOF symbol are
+// rejected with ErrTrailingData; see DecompressTrailer.
 func (huff *Huffman) DecompressTo(dst, data []byte) ([]byte, error) {
-	if huff == nil || !huff.Dictionary.isInitialized() {
-		return nil, fmt.Errorf("%w: dictionary is nil or uninitialized", ErrHuffmanDecompress)
+	if _, err := huff.dictionary(ErrHuffmanDecompress); err != nil {
+		return nil, err
 	}
 	if len(data) == 0 {
 		return dst, nil
 	}
+	out, consumedBits, err := huff.decompressTo(dst, data)
+	if err != nil {
+		return nil, err
+	}
+	if err = huff.checkDecoded(len(out) - len(dst)); err != nil {
+		return nil, err
+	}
+	if huff.Strict {
+		if err = trailerOf(data, consumedBits).check(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// DecompressTrailer is DecompressTo that also reports what followed the EOF
+// symbol: how many input bytes the stream occupied and whether the padding
+// bits and any remaining bytes were zero. The trailer is only meaningful when
+// err is nil, or when err is ErrTrailingData under Strict.
+func (huff *Huffman) DecompressTrailer(dst, data []byte) ([]byte, Trailer, error) {
+	if _, err := huff.dictionary(ErrHuffmanDecompress); err != nil {
+		return nil, Trailer{}, err
+	}
+	if len(data) == 0 {
+		return dst, Trailer{PaddingZero: true, ExtraZero: true}, nil
+	}
+	out, consumedBits, err := huff.decompressTo(dst, data)
+	if err != nil {
+		return nil, Trailer{}, err
+	}
+	if err = huff.checkDecoded(len(out) - len(dst)); err != nil {
+		return nil, Trailer{}, err
+	}
+	t := trailerOf(data, consumedBits)
+	if huff.Strict {
+		if err = t.check(); err != nil {
+			return nil, t, err
+		}
+	}
+	return out, t, nil
+}
+
+// checkDecoded enforces OutputLimit on a decoded stream of n bytes.
+func (huff *Huffman) checkDecoded(n int) error {
+	if huff.OutputLimit > 0 && int64(n) > huff.OutputLimit {
+		return fmt.Errorf("%w: %w: stream decodes to more than %d bytes", ErrHuffmanDecompress, ErrOutputLimit, huff.OutputLimit)
+	}
+	return nil
+}
+
+// checkEncoded enforces OutputLimit on an encoded stream of n bytes.
+func (huff *Huffman) checkEncoded(n int) error {
+	if huff.OutputLimit > 0 && int64(n) > huff.OutputLimit {
+		return fmt.Errorf("%w: %w: stream needs %d bytes, limit is %d", ErrHuffmanCompress, ErrOutputLimit, n, huff.OutputLimit)
+	}
+	return nil
+}
 
+// decompressTo is the decoder behind DecompressTo. Besides the output it
+// returns the number of input bits the stream occupied, EOF symbol included.
+// data must not be empty and huff.Dictionary must be usable.
+//
+// OutputLimit is only enforced loosely here, once per refill, so that a
+// stream far beyond it is abandoned early; callers check the exact size.
+func (huff *Huffman) decompressTo(dst, data []byte) ([]byte, int, error) {
 	d := huff.Dictionary
-	if d.maxCodeLen > maxStoredCodeBits {
-		return nil, fmt.Errorf("%w: dictionary contains %d-bit codes, maximum supported is %d", ErrHuffmanDecompress, d.maxCodeLen, maxStoredCodeBits)
+	start, stop := len(dst), math.MaxInt
+	if huff.OutputLimit > 0 && huff.OutputLimit < int64(math.MaxInt-start) {
+		stop = start + int(huff.OutputLimit)
 	}
 	lut := &d.decLut
 	nodes := &d.nodes
@@ -152,6 +256,10 @@ bulk:
 	// A refill guarantees 56 bits, so the unchecked bulk loop is only usable
 	// when a single code can never exceed that.
 	for maxLen <= 56 {
+		if len(dst) > stop {
+			return nil, 0, huff.checkDecoded(len(dst) - start)
+		}
+
 		// Refill to at least 56 valid bits. The fast path loads 8 bytes at
 		// once and only claims the whole bytes it consumed; the leftover
 		// partial byte is simply re-read on the next refill.
@@ -179,7 +287,7 @@ bulk:
 				acc >>= codeLen
 				bitCount -= codeLen
 				if entry&lutEOFBit != 0 {
-					return dst, nil
+					return dst, srcIndex*8 - int(bitCount), nil
 				}
 				dst = append(dst, byte(entry>>lutSymShift))
 				continue
@@ -198,7 +306,7 @@ bulk:
 				bitCount--
 
 				if idx >= uint32(len(nodes)) {
-					return nil, fmt.Errorf("%w: invalid stream: walked off the tree", ErrHuffmanDecompress)
+					return nil, 0, fmt.Errorf("%w: invalid stream: walked off the tree", ErrHuffmanDecompress)
 				}
 				if nodes[idx].NumBits != 0 {
 					break
@@ -206,7 +314,7 @@ bulk:
 			}
 
 			if idx == EofSymbol {
-				return dst, nil
+				return dst, srcIndex*8 - int(bitCount), nil
 			}
 			dst = append(dst, nodes[idx].Symbol)
 		}
@@ -223,49 +331,16 @@ bulk:
 			bitCount += 8
 		}
 
-		entry := lut[acc&lookupTableMask]
-		codeLen := uint(entry & lutLenMask)
-
-		if codeLen != 0 {
-			if codeLen > bitCount {
-				return nil, fmt.Errorf("%w: truncated stream: need %d bits, have %d", ErrHuffmanDecompress, codeLen, bitCount)
-			}
-			acc >>= codeLen
-			bitCount -= codeLen
-			if entry&lutEOFBit != 0 {
-				return dst, nil
-			}
-			dst = append(dst, byte(entry>>lutSymShift))
-			continue
-		}
-
-		if bitCount < lookupTableBits {
-			return nil, fmt.Errorf("%w: truncated stream: need %d bits, have %d", ErrHuffmanDecompress, lookupTableBits, bitCount)
+		sym, codeLen, err := d.decodeSymbol(acc, bitCount)
+		if err != nil {
+			return nil, 0, err
 		}
-		idx := entry >> lutNodeShift
-		acc >>= lookupTableBits
-		bitCount -= lookupTableBits
-
-		for {
-			if bitCount == 0 {
-				return nil, fmt.Errorf("%w: truncated stream: symbol not terminated", ErrHuffmanDecompress)
-			}
-			idx = uint32(nodes[idx].Leafs[acc&1])
-			acc >>= 1
-			bitCount--
-
-			if idx >= uint32(len(nodes)) {
-				return nil, fmt.Errorf("%w: invalid stream: walked off the tree", ErrHuffmanDecompress)
-			}
-			if nodes[idx].NumBits != 0 {
-				break
-			}
-		}
-
-		if idx == EofSymbol {
-			return dst, nil
+		acc >>= codeLen
+		bitCount -= codeLen
+		if sym == EofSymbol {
+			return dst, srcIndex*8 - int(bitCount), nil
 		}
-		dst = append(dst, nodes[idx].Symbol)
+		dst = append(dst, byte(sym))
 	}
 }
 
@@ -276,21 +351,11 @@ bulk:
 // require. Returning an empty slice here would produce a stream neither of
 // them can decode.
 func (huff *Huffman) Compress(data []byte) ([]byte, error) {
-	if huff == nil || !huff.Dictionary.isInitialized() {
-		return nil, fmt.Errorf("%w: dictionary is nil or uninitialized", ErrHuffmanCompress)
-	}
-	d := huff.Dictionary
-
-	// Codes are stored as uint32 in Dictionary. Reject deeper custom trees
-	// explicitly instead of silently truncating their codes and emitting a
-	// corrupt stream. The default Teeworlds dictionary tops out at 15 bits.
-	if d.maxCodeLen > maxStoredCodeBits {
-		return nil, fmt.Errorf("%w: dictionary contains %d-bit codes, maximum supported is %d", ErrHuffmanCompress, d.maxCodeLen, maxStoredCodeBits)
+	d, err := huff.dictionary(ErrHuffmanCompress)
+	if err != nil {
+		return nil, err
 	}
 
-	encBits := &d.encBits
-	encLen := &d.encLen
-
 	// Exact worst case: every symbol at the longest code, plus the EOF code
 	// and the final partial byte. Sizing up front removes every bounds check
 	// and every realloc from the hot loop.
@@ -300,7 +365,36 @@ func (huff *Huffman) Compress(data []byte) ([]byte, error) {
 	}
 	dst := make([]byte, int(size))
 
+	pos, _ := d.encode(dst, data, huff.LegacyPadding, noLimit)
+	if err := huff.checkEncoded(pos); err != nil {
+		return nil, err
+	}
+
+	// The worst-case buffer is ~1.9x the real output for the default
+	// dictionary. Hand back a right-sized slice when we overshot badly,
+	// rather than pinning the oversized array in the caller's heap -- but
+	// only when the waste justifies a second allocation plus a copy. Packet
+	// sized payloads stay at exactly one allocation.
+	if len(dst)-pos > 8192 && uint64(pos)*2 < uint64(len(dst)) {
+		out := make([]byte, pos)
+		copy(out, dst[:pos])
+		return out, nil
+	}
+	return dst[:pos], nil
+}
+
+// noLimit is the limit for encode that is never reached.
+const noLimit = math.MaxInt
+
+// encode writes the stream for data, EOF symbol included, to the start of
+// buf and returns its length. It gives up and reports false as soon as the
+// stream is certain to exceed limit bytes. buf must have room for the worst
+// case, see compressBufSize, or for limit+8 bytes. legacy is
+// Huffman.LegacyPadding.
+func (d *Dictionary) encode(buf, data []byte, legacy bool, limit int) (int, bool) {
 	var (
+		encBits  = &d.encBits
+		encLen   = &d.encLen
 		acc      uint64
 		bitCount uint
 		pos      int
@@ -311,7 +405,11 @@ func (huff *Huffman) Compress(data []byte) ([]byte, error) {
 		bitCount += uint(encLen[symbol])
 
 		if bitCount >= 32 {
-			binary.LittleEndian.PutUint32(dst[pos:], uint32(acc))
+			// these four bytes plus at least one for the EOF symbol
+			if pos+5 > limit {
+				return pos, false
+			}
+			binary.LittleEndian.PutUint32(buf[pos:], uint32(acc))
 			pos += 4
 			acc >>= 32
 			bitCount -= 32
@@ -322,7 +420,7 @@ func (huff *Huffman) Compress(data []byte) ([]byte, error) {
 	bitCount += uint(encLen[EofSymbol])
 
 	for bitCount >= 8 {
-		dst[pos] = byte(acc)
+		buf[pos] = byte(acc)
 		pos++
 		acc >>= 8
 		bitCount -= 8
@@ -331,22 +429,52 @@ func (huff *Huffman) Compress(data []byte) ([]byte, error) {
 	// and older ddnet always wrote this byte even when empty; ddnet dropped
 	// the redundant zero byte in 4354f8c6. It sits after the EOF symbol, so
 	// every decoder ignores it either way.
-	if bitCount != 0 {
-		dst[pos] = byte(acc)
+	if bitCount != 0 || legacy {
+		buf[pos] = byte(acc)
 		pos++
 	}
 
-	// The worst-case buffer is ~1.9x the real output for the default
-	// dictionary. Hand back a right-sized slice when we overshot badly,
-	// rather than pinning the oversized array in the caller's heap -- but
-	// only when the waste justifies a second allocation plus a copy. Packet
-	// sized payloads stay at exactly one allocation.
-	if len(dst)-pos > 8192 && uint64(pos)*2 < uint64(len(dst)) {
-		out := make([]byte, pos)
-		copy(out, dst[:pos])
-		return out, nil
+	return pos, pos <= limit
+}
+
+// CompressIfSmaller appends the compressed form of data to dst if it is
+// strictly smaller than data, and data itself otherwise, reporting which one
+// it wrote. This is the decision teeworlds makes for NET_PACKETFLAG_COMPRESSION.
+// Encoding stops as soon as the output is certain to reach len(data) bytes,
+// so incompressible payloads cost little more than the copy. dst and data
+// must not share backing storage.
+func (huff *Huffman) CompressIfSmaller(dst, data []byte) ([]byte, bool, error) {
+	d, err := huff.dictionary(ErrHuffmanCompress)
+	if err != nil {
+		return nil, false, err
 	}
-	return dst[:pos], nil
+	if len(data) == 0 {
+		return dst, false, nil
+	}
+
+	// Room for len(data)-1 bytes of output plus the slack encode needs.
+	// Both outcomes fit, so this is the only allocation.
+	need := uint64(len(data)) + 8
+	if need > maxAlloc-uint64(len(dst)) {
+		return nil, false, fmt.Errorf("%w: input of %d bytes needs more than %d bytes of output buffer", ErrHuffmanCompress, len(data), uint64(maxAlloc))
+	}
+	if uint64(cap(dst)-len(dst)) < need {
+		grown := make([]byte, len(dst), len(dst)+int(need))
+		copy(grown, dst)
+		dst = grown
+	}
+
+	// As in the reference PackPacket, compressed output beyond OutputLimit
+	// falls back to the raw payload rather than failing.
+	limit := len(data) - 1
+	if huff.OutputLimit > 0 && huff.OutputLimit < int64(limit) {
+		limit = int(huff.OutputLimit)
+	}
+	buf := dst[len(dst) : len(dst)+int(need)]
+	if n, ok := d.encode(buf, data, huff.LegacyPadding, limit); ok {
+		return dst[:len(dst)+n], true, nil
+	}
+	return append(dst, data...), false, nil
 }
 
 // Buffer sizing arithmetic, kept in one place and parameterised by limit (the
@@ -410,3 +538,18 @@ func compressBufSize(inputLen int, maxCodeLen uint8, limit uint64) (uint64, bool
 	}
 	return size, true
 }
+
+// decompressBufSize is the hard upper bound on the output for a compressed
+// payload of inputLen bytes: one symbol per input bit, plus slack for the final
+// refill. Reports false when that cannot be represented on this platform.
+func decompressBufSize(inputLen int, limit uint64) (uint64, bool) {
+	n := uint64(inputLen)
+	if n > (^uint64(0)-8)/8 {
+		return 0, false
+	}
+	size := n*8 + 8
+	if size > limit {
+		return 0, false
+	}
+	return size, true
+}
@@ -50,3 +50,47 @@ func ExampleHuffman_Decompress() {
 	// Output:
 	// data: hello world
 }
+
+func ExampleNewHuffman() {
+	// reject packets that decode to more than a teeworlds payload can hold,
+	// or that carry anything after the EOF symbol
+	huff := huffman.NewHuffman(
+		huffman.WithOutputLimit(1394),
+		huffman.WithStrict(true),
+	)
+
+	data, err := huff.Decompress([]byte{174, 149, 19, 92, 9, 87, 194, 22, 177, 86, 220, 218, 34, 56, 185, 18, 156, 168, 184, 1})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("data: %v\n", string(data))
+	// Output:
+	// data: hello world
+}
+
+func ExampleBitWriter() {
+	// a 4 bit version field followed by a Huffman coded string
+	w := huffman.NewBitWriter(huffman.DefaultDictionary, nil)
+	_ = w.WriteBits(3, 4)
+	for _, c := range []byte("hi") {
+		_ = w.WriteSymbol(int(c))
+	}
+	_ = w.WriteSymbol(huffman.EofSymbol)
+
+	r := huffman.NewBitReader(huffman.DefaultDictionary, w.Bytes())
+	version, _ := r.ReadBits(4)
+	var s []byte
+	for {
+		sym, err := r.ReadSymbol()
+		if err != nil {
+			panic(err)
+		}
+		if sym == huffman.EofSymbol {
+			break
+		}
+		s = append(s, byte(sym))
+	}
+	fmt.Println(version, string(s))
+	// Output:
+	// 3 hi
+}
@@ -252,3 +252,55 @@ func BenchmarkDecompressTo(b *testing.B) {
 		}
 	}
 }
+
+// CompressIfSmaller must make exactly the decision teeworlds makes around
+// Compress, for every payload, and append its result after dst's contents.
+func TestCompressIfSmaller(t *testing.T) {
+	huff := NewHuffman()
+	inputs := [][]byte{nil, {0}, {0xff}}
+	for _, e := range regressionCorpus() {
+		inputs = append(inputs, e.data)
+	}
+	for seed := int64(0); seed < 64; seed++ {
+		inputs = append(inputs, randomBytes(seed, int(seed)), skewedBytes(seed, int(seed)*3))
+	}
+
+	for _, in := range inputs {
+		full, err := huff.Compress(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantCompressed := len(full) < len(in)
+		want := in
+		if wantCompressed {
+			want = full
+		}
+
+		prefix := []byte("header")
+		out, compressed, err := huff.CompressIfSmaller(append([]byte(nil), prefix...), in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compressed != wantCompressed {
+			t.Fatalf("%d bytes: compressed = %v, want %v (Compress gives %d bytes)", len(in), compressed, wantCompressed, len(full))
+		}
+		if !bytes.Equal(out[:len(prefix)], prefix) || !bytes.Equal(out[len(prefix):], want) {
+			t.Fatalf("%d bytes: CompressIfSmaller = %x, want %x%x", len(in), out, prefix, want)
+		}
+	}
+}
+
+func TestCompressIfSmallerZeroAlloc(t *testing.T) {
+	huff := NewHuffman()
+	for _, in := range [][]byte{snapshotLike(61, 1400), randomBytes(61, 1400)} {
+		dst := make([]byte, 0, 2048)
+		allocs := testing.AllocsPerRun(100, func() {
+			if _, _, err := huff.CompressIfSmaller(dst, in); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Fatalf("CompressIfSmaller with a reused buffer allocated %.0f times", allocs)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package huffman
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// TestReaderContainer parses a compressed blob followed by raw data out of
+// one stream.
+func TestReaderContainer(t *testing.T) {
+	raw := []byte("uncompressed tail, read from the same stream")
+	for _, e := range regressionCorpus() {
+		compressed, err := Compress(e.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		container := append(append([]byte(nil), compressed...), raw...)
+
+		for _, size := range []int{16, 33, 4096} {
+			src := iotest.HalfReader(bytes.NewReader(container))
+			r := NewReader(src, WithBufferSize(size))
+			if r.InputOffset() != 0 {
+				t.Fatalf("%s: InputOffset before reading = %d", e.name, r.InputOffset())
+			}
+			got, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, e.data) {
+				t.Fatalf("%s, buffer %d: blob = %d bytes, %v", e.name, size, len(got), err)
+			}
+			if off := r.InputOffset(); off != int64(len(compressed)) {
+				t.Fatalf("%s, buffer %d: InputOffset = %d, want %d", e.name, size, off, len(compressed))
+			}
+			tail, err := io.ReadAll(io.MultiReader(r.Buffered(), src))
+			if err != nil || !bytes.Equal(tail, raw) {
+				t.Fatalf("%s, buffer %d: tail = %q, %v, want %q", e.name, size, tail, err, raw)
+			}
+		}
+	}
+}
+
+func TestReaderInputOffsetMidStream(t *testing.T) {
+	data := snapshotLike(37, 3000)
+	compressed, err := Compress(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(bytes.NewReader(compressed), WithBufferSize(64))
+	buf := make([]byte, 100)
+	var last int64
+	for {
+		_, err := r.Read(buf)
+		off := r.InputOffset()
+		if off < last || off > int64(len(compressed)) {
+			t.Fatalf("InputOffset = %d after %d, stream has %d bytes", off, last, len(compressed))
+		}
+		last = off
+		// what has not been consumed is still there to read
+		rest, _ := io.ReadAll(io.MultiReader(r.Buffered(), bytes.NewReader(compressed[r.read:])))
+		if !bytes.Equal(rest, compressed[off:]) {
+			t.Fatalf("at offset %d: Buffered and the source do not continue the stream", off)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// teeworlds 0.7 padding byte is left for the caller
+	in := make([]byte, 64)
+	in[0] = 0x15
+	legacy, err := NewHuffman(WithLegacyPadding(true)).Compress(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = NewReader(bytes.NewReader(legacy))
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := io.ReadAll(r.Buffered()); r.InputOffset() != int64(len(legacy)-1) || !bytes.Equal(rest, []byte{0}) {
+		t.Fatalf("legacy stream: InputOffset = %d, Buffered = %x, want %d and the zero byte", r.InputOffset(), rest, len(legacy)-1)
+	}
+}
@@ -0,0 +1,124 @@
+// Package msg reads and writes the fields of teeworlds net messages, the
+// contents of a packet chunk: the message header and the ints, strings and
+// raw bytes that follow it. Unpacker and Packer follow CUnpacker and CPacker
+// of the reference implementations, including their sticky error state: after
+// the first error every read returns a zero value and every write is dropped,
+// so a message can be handled field by field with a single check at the end.
+package msg
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+
+	"github.com/teeworlds-go/huffman/v2/packet"
+)
+
+var (
+	ErrInvalidMessage = errors.New("invalid message")
+)
+
+const (
+	// MaxSize is the size of the reference CPacker buffer, the largest
+	// message a Packer builds.
+	MaxSize = 2048
+
+	// idEx is NETMSG_EX, the message ID ddnet sends in front of the UUID of
+	// an extended message on 0.6 connections.
+	idEx = 0
+
+	// maxID is the first ID ddnet no longer accepts, where its UUID based
+	// IDs start.
+	maxID = 1 << 16
+)
+
+// UUID identifies a ddnet extended message, and likewise an extended
+// snapshot item type.
+type UUID [16]byte
+
+// namespace is TEEWORLDS_NAMESPACE, under which ddnet derives the UUIDs of its
+// extensions from their names.
+var namespace = UUID{0xe0, 0x5d, 0xda, 0xaa, 0xc4, 0xe6, 0x4c, 0xfb, 0xb6, 0x42, 0x5d, 0x48, 0xe8, 0x0c, 0x00, 0x29}
+
+// UUIDFromName returns the UUID ddnet's CalculateUuid derives from name, such
+// as "what-is@ddnet.tw": an RFC 4122 version 3 UUID in its namespace.
+func UUIDFromName(name string) UUID {
+	h := md5.New()
+	h.Write(namespace[:])
+	h.Write([]byte(name))
+	var u UUID
+	h.Sum(u[:0])
+	u[6] = u[6]&0x0f | 0x30
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+func (u UUID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// Header is the header every message starts with: its ID and whether it is a
+// system message of the engine rather than a game message.
+type Header struct {
+	ID     int
+	System bool
+
+	// Extended is set for a ddnet extended message, which is identified by
+	// UUID instead of ID. ID is zero then. 0.6 only.
+	Extended bool
+	UUID     UUID
+}
+
+// UnpackHeader reads a message header of version v, the way ddnet's
+// CNetBase::UnpackMessageId does for 0.6 and CUnpacker::GetInt for 0.7.
+func (u *Unpacker) UnpackHeader(v packet.Version) Header {
+	if v != packet.Version06 && v != packet.Version07 {
+		u.fail(fmt.Errorf("%w: unknown version %s", ErrInvalidMessage, v))
+		return Header{}
+	}
+	msg := u.Int()
+	if u.err != nil {
+		return Header{}
+	}
+	h := Header{ID: int(msg >> 1), System: msg&1 != 0}
+	if h.ID < 0 || h.ID >= maxID {
+		u.fail(fmt.Errorf("%w: message ID %d out of range", ErrInvalidMessage, h.ID))
+		return Header{}
+	}
+	if v == packet.Version06 && h.ID == idEx {
+		raw := u.Raw(len(h.UUID))
+		if u.err != nil {
+			return Header{}
+		}
+		h.Extended = true
+		copy(h.UUID[:], raw)
+	}
+	return h
+}
+
+// AddHeader writes the message header h of version v. Extended headers only
+// exist in 0.6.
+func (p *Packer) AddHeader(v packet.Version, h Header) {
+	switch {
+	case v != packet.Version06 && v != packet.Version07:
+		p.fail(fmt.Errorf("%w: unknown version %s", ErrInvalidMessage, v))
+		return
+	case h.Extended && v != packet.Version06:
+		p.fail(fmt.Errorf("%w: extended messages need version %s", ErrInvalidMessage, packet.Version06))
+		return
+	case h.Extended:
+		h.ID = idEx
+	case h.ID < 0 || h.ID >= maxID || (h.ID == idEx && v == packet.Version06):
+		p.fail(fmt.Errorf("%w: message ID %d out of range", ErrInvalidMessage, h.ID))
+		return
+	}
+
+	msg := int32(h.ID) << 1
+	if h.System {
+		msg |= 1
+	}
+	p.AddInt(msg)
+	if h.Extended {
+		p.AddRaw(h.UUID[:])
+	}
+}
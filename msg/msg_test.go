@@ -0,0 +1,176 @@
+package msg
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/teeworlds-go/huffman/v2/packet"
+)
+
+// netmsgInfo07 is the NETMSG_INFO a 0.7 client sends first: system message 1
+// with the net version, an empty password and the client version.
+var netmsgInfo07 = []byte{
+	0x03,
+	'0', '.', '7', ' ', '8', '0', '2', 'f', '1', 'b', 'e', '6', '0', 'a', '0', '5', '6', '6', '5', 'f', 0x00,
+	0x00,
+	0x85, 0x1c,
+}
+
+func TestUnpackInfo07(t *testing.T) {
+	u := NewUnpacker(netmsgInfo07)
+	h := u.UnpackHeader(packet.Version07)
+	version := u.String(Sanitize)
+	password := u.String(Sanitize)
+	client := u.Int()
+	if err := u.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if h != (Header{ID: 1, System: true}) {
+		t.Errorf("header = %+v", h)
+	}
+	if version != "0.7 802f1be60a05665f" || password != "" || client != 0x0705 {
+		t.Errorf("got %q, %q, %#x", version, password, client)
+	}
+	if len(u.Rest()) != 0 {
+		t.Errorf("%d bytes left", len(u.Rest()))
+	}
+
+	var p Packer
+	p.AddHeader(packet.Version07, h)
+	p.AddString(version, 0)
+	p.AddString(password, 0)
+	p.AddInt(client)
+	if p.Err() != nil || !bytes.Equal(p.Bytes(), netmsgInfo07) {
+		t.Fatalf("packed %x, %v, want %x", p.Bytes(), p.Err(), netmsgInfo07)
+	}
+}
+
+func TestHeaderRoundTrip(t *testing.T) {
+	uuid := UUID{0xe0, 0x5d, 0xda, 0xaa, 0xc4, 0xe6, 0x4c, 0xfb, 0xb6, 0x42, 0x5d, 0x48, 0xe8, 0x0c, 0x00, 0x29}
+	table := []struct {
+		name    string
+		version packet.Version
+		header  Header
+		want    []byte
+	}{
+		{"0.6 game", packet.Version06, Header{ID: 3}, []byte{0x06}},
+		{"0.6 system", packet.Version06, Header{ID: 23, System: true}, []byte{0x2f}},
+		{"0.6 extended", packet.Version06, Header{System: true, Extended: true, UUID: uuid}, append([]byte{0x01}, uuid[:]...)},
+		{"0.7 null", packet.Version07, Header{System: true}, []byte{0x01}},
+		{"0.7 large", packet.Version07, Header{ID: maxID - 1}, []byte{0xbe, 0xff, 0x0f}},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			var p Packer
+			p.AddHeader(test.version, test.header)
+			if p.Err() != nil || !bytes.Equal(p.Bytes(), test.want) {
+				t.Fatalf("packed %x, %v, want %x", p.Bytes(), p.Err(), test.want)
+			}
+			u := NewUnpacker(append(p.Bytes(), 0xaa))
+			if h := u.UnpackHeader(test.version); h != test.header || u.Err() != nil {
+				t.Fatalf("unpacked %+v, %v, want %+v", h, u.Err(), test.header)
+			}
+			if !bytes.Equal(u.Rest(), []byte{0xaa}) {
+				t.Fatalf("rest = %x", u.Rest())
+			}
+		})
+	}
+}
+
+func TestHeaderInvalid(t *testing.T) {
+	unpack := []struct {
+		name    string
+		version packet.Version
+		data    []byte
+	}{
+		{"empty", packet.Version06, nil},
+		{"negative ID", packet.Version07, []byte{0x40}},
+		{"ID too large", packet.Version07, []byte{0x80, 0x80, 0x10}},
+		{"truncated UUID", packet.Version06, []byte{0x00, 0x01, 0x02}},
+		{"unknown version", packet.Version(5), []byte{0x02}},
+	}
+	for _, test := range unpack {
+		t.Run("unpack "+test.name, func(t *testing.T) {
+			u := NewUnpacker(test.data)
+			if h := u.UnpackHeader(test.version); h != (Header{}) || !errors.Is(u.Err(), ErrInvalidMessage) {
+				t.Fatalf("got %+v, %v, want ErrInvalidMessage", h, u.Err())
+			}
+		})
+	}
+
+	pack := []struct {
+		name    string
+		version packet.Version
+		header  Header
+	}{
+		{"0.6 ID 0", packet.Version06, Header{}},
+		{"0.7 extended", packet.Version07, Header{Extended: true}},
+		{"negative ID", packet.Version07, Header{ID: -1}},
+		{"ID too large", packet.Version07, Header{ID: maxID}},
+		{"unknown version", packet.Version(5), Header{ID: 1}},
+	}
+	for _, test := range pack {
+		t.Run("pack "+test.name, func(t *testing.T) {
+			var p Packer
+			p.AddHeader(test.version, test.header)
+			if p.Len() != 0 || !errors.Is(p.Err(), ErrInvalidMessage) {
+				t.Fatalf("packed %x, %v, want ErrInvalidMessage", p.Bytes(), p.Err())
+			}
+		})
+	}
+}
+
+// A message goes through the packet layer and comes out field for field.
+func TestMessageThroughPacket(t *testing.T) {
+	var p Packer
+	p.AddHeader(packet.Version06, Header{ID: 5})
+	p.AddString("hello from a bot", 0)
+	p.AddInt(-1)
+
+	b := packet.NewBuilder(packet.Version06, nil)
+	if err := b.AddChunk(packet.ChunkHeader{Flags: packet.ChunkVital, Seq: 1}, p.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := b.Pack(nil, packet.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, payload, err := packet.Unpack(nil, packet.Version06, nil, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for c, err := range packet.Chunks(packet.Version06, payload) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := NewUnpacker(c.Body)
+		h := u.UnpackHeader(packet.Version06)
+		s := u.String(Sanitize)
+		i := u.Int()
+		if u.Err() != nil || h.ID != 5 || h.System || s != "hello from a bot" || i != -1 {
+			t.Fatalf("got %+v, %q, %d, %v", h, s, i, u.Err())
+		}
+	}
+}
+
+func TestUUIDFromName(t *testing.T) {
+	if got := namespace.String(); got != "e05ddaaa-c4e6-4cfb-b642-5d48e80c0029" {
+		t.Fatalf("namespace = %s", got)
+	}
+	// the system messages of ddnet's protocol_ex_msgs.h
+	for name, want := range map[string]string{
+		"what-is@ddnet.tw":     "245e5097-9fe0-39d6-bf7d-9a29e1691e4c",
+		"it-is@ddnet.tw":       "6954847e-2e87-3603-b562-36da29ed1aca",
+		"i-dont-know@ddnet.tw": "416911b5-7973-33bf-8d52-7bf01e519cf0",
+	} {
+		u := UUIDFromName(name)
+		if got := u.String(); got != want {
+			t.Errorf("UUIDFromName(%q) = %s, want %s", name, got, want)
+		}
+		if u[6]>>4 != 3 || u[8]>>6 != 2 {
+			t.Errorf("%s is not a version 3 RFC 4122 UUID", u)
+		}
+	}
+}
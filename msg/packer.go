@@ -0,0 +1,95 @@
+package msg
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/teeworlds-go/huffman/v2"
+)
+
+// Packer builds a message, up to MaxSize bytes, ready to be put in a chunk
+// and compressed. The zero value is an empty Packer ready to use.
+type Packer struct {
+	buf []byte
+	err error
+}
+
+// Reset empties p and clears its error, keeping its buffer.
+func (p *Packer) Reset() {
+	p.buf = p.buf[:0]
+	p.err = nil
+}
+
+// Err returns the first error p ran into, or nil.
+func (p *Packer) Err() error {
+	return p.err
+}
+
+// Bytes returns the message built so far. It shares storage with p and is
+// valid until the next change to p.
+func (p *Packer) Bytes() []byte {
+	return p.buf
+}
+
+// Len returns the size of the message built so far.
+func (p *Packer) Len() int {
+	return len(p.buf)
+}
+
+func (p *Packer) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// reserve checks that n more bytes fit, failing p if they do not.
+func (p *Packer) reserve(n int) bool {
+	if p.err != nil {
+		return false
+	}
+	if n > MaxSize-len(p.buf) {
+		p.fail(fmt.Errorf("%w: %d more bytes exceed the maximum message size of %d", ErrInvalidMessage, n, MaxSize))
+		return false
+	}
+	if p.buf == nil {
+		p.buf = make([]byte, 0, MaxSize)
+	}
+	return true
+}
+
+// AddInt writes v packed with CVariableInt, see huffman.AppendVarInt.
+func (p *Packer) AddInt(v int32) {
+	var tmp [huffman.MaxVarIntLen]byte
+	enc := huffman.AppendVarInt(tmp[:0], v)
+	if p.reserve(len(enc)) {
+		p.buf = append(p.buf, enc...)
+	}
+}
+
+// AddString writes s with its zero terminator. s ends at its first zero
+// byte, if any, and is cut to at most limit bytes when limit is positive,
+// without splitting a UTF-8 sequence, as ddnet's CPacker::AddString does.
+func (p *Packer) AddString(s string, limit int) {
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	if limit > 0 && len(s) > limit {
+		end := limit
+		for end > 0 && !utf8.RuneStart(s[end]) {
+			end--
+		}
+		s = s[:end]
+	}
+	if p.reserve(len(s) + 1) {
+		p.buf = append(p.buf, s...)
+		p.buf = append(p.buf, 0)
+	}
+}
+
+// AddRaw writes data as it is.
+func (p *Packer) AddRaw(data []byte) {
+	if p.reserve(len(data)) {
+		p.buf = append(p.buf, data...)
+	}
+}
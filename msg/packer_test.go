@@ -0,0 +1,83 @@
+package msg
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPackerString(t *testing.T) {
+	table := []struct {
+		s     string
+		limit int
+		want  string
+	}{
+		{"name", 0, "name\x00"},
+		{"name", 4, "name\x00"},
+		{"nameless", 4, "name\x00"},
+		{"cut\x00off", 0, "cut\x00"},
+		// a limit inside a UTF-8 sequence drops the whole sequence
+		{"äöü", 3, "ä\x00"},
+		{"äöü", 4, "äö\x00"},
+		{"", 0, "\x00"},
+	}
+	for _, test := range table {
+		var p Packer
+		p.AddString(test.s, test.limit)
+		if got := string(p.Bytes()); got != test.want || p.Err() != nil {
+			t.Errorf("AddString(%q, %d) = %q, %v, want %q", test.s, test.limit, got, p.Err(), test.want)
+		}
+	}
+}
+
+func TestPackerMaxSize(t *testing.T) {
+	var p Packer
+	p.AddRaw(make([]byte, MaxSize-2))
+	p.AddInt(1)
+	if p.Len() != MaxSize-1 || p.Err() != nil {
+		t.Fatalf("Len = %d, err = %v", p.Len(), p.Err())
+	}
+
+	p.AddInt(64) // two bytes, one too many
+	if !errors.Is(p.Err(), ErrInvalidMessage) || p.Len() != MaxSize-1 {
+		t.Fatalf("Len = %d, err = %v, want ErrInvalidMessage", p.Len(), p.Err())
+	}
+	// dropped after the error, even if it would fit
+	p.AddRaw([]byte{1})
+	if p.Len() != MaxSize-1 {
+		t.Fatalf("write after error: Len = %d", p.Len())
+	}
+
+	p.Reset()
+	if p.Len() != 0 || p.Err() != nil {
+		t.Fatalf("after Reset: Len = %d, err = %v", p.Len(), p.Err())
+	}
+	p.AddString(strings.Repeat("x", MaxSize), 0)
+	if !errors.Is(p.Err(), ErrInvalidMessage) {
+		t.Fatalf("oversized string: err = %v", p.Err())
+	}
+}
+
+func TestPackerUnpackerRoundTrip(t *testing.T) {
+	ints := []int32{0, 1, -1, 63, 64, -65, 1 << 20, -1 << 31, 1<<31 - 1}
+	var p Packer
+	for _, v := range ints {
+		p.AddInt(v)
+		p.AddString("s", 0)
+	}
+	p.AddRaw([]byte{0xde, 0xad})
+
+	u := NewUnpacker(p.Bytes())
+	for _, want := range ints {
+		if v := u.Int(); v != want {
+			t.Errorf("Int = %d, want %d", v, want)
+		}
+		if s := u.String(Sanitize); s != "s" {
+			t.Errorf("String = %q", s)
+		}
+	}
+	if raw := u.Raw(2); !bytes.Equal(raw, []byte{0xde, 0xad}) || u.Err() != nil {
+		t.Fatalf("Raw = %x, %v", raw, u.Err())
+	}
+}
@@ -0,0 +1,117 @@
+package msg
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/teeworlds-go/huffman/v2"
+)
+
+// StringMode selects how Unpacker.String cleans up a string, like the
+// SanitizeType of CUnpacker::GetString.
+type StringMode uint8
+
+const (
+	// Sanitize replaces control characters other than tab, newline and
+	// carriage return with spaces.
+	Sanitize StringMode = 1 << iota
+	// SanitizeCC replaces every control character with a space. Sanitize
+	// takes precedence if both are given.
+	SanitizeCC
+	// SkipStartWhitespaces drops leading spaces, tabs and line breaks.
+	SkipStartWhitespaces
+)
+
+// Unpacker reads the fields of a message from a decompressed chunk body. The
+// zero value reads from an empty message.
+type Unpacker struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// NewUnpacker creates an Unpacker reading data.
+func NewUnpacker(data []byte) *Unpacker {
+	return &Unpacker{data: data}
+}
+
+// Reset makes u read data and clears its error.
+func (u *Unpacker) Reset(data []byte) {
+	*u = Unpacker{data: data}
+}
+
+// Err returns the first error u ran into, or nil.
+func (u *Unpacker) Err() error {
+	return u.err
+}
+
+// Rest returns the data not read yet. It shares storage with the data u reads.
+func (u *Unpacker) Rest() []byte {
+	return u.data[u.pos:]
+}
+
+func (u *Unpacker) fail(err error) {
+	if u.err == nil {
+		u.err = err
+	}
+}
+
+// Int reads an integer packed with CVariableInt, see huffman.ReadVarInt.
+func (u *Unpacker) Int() int32 {
+	if u.err != nil {
+		return 0
+	}
+	v, n, err := huffman.ReadVarInt(u.data[u.pos:])
+	if err != nil {
+		u.fail(fmt.Errorf("%w: int at offset %d: %w", ErrInvalidMessage, u.pos, err))
+		return 0
+	}
+	u.pos += n
+	return v
+}
+
+// String reads a zero-terminated string and cleans it up as mode says. A
+// string lacking its terminator is an error.
+func (u *Unpacker) String(mode StringMode) string {
+	if u.err != nil {
+		return ""
+	}
+	rest := u.data[u.pos:]
+	end := bytes.IndexByte(rest, 0)
+	if end < 0 {
+		u.fail(fmt.Errorf("%w: string at offset %d is not terminated", ErrInvalidMessage, u.pos))
+		return ""
+	}
+	u.pos += end + 1
+	s := rest[:end]
+
+	if mode&(Sanitize|SanitizeCC) != 0 {
+		clean := make([]byte, len(s))
+		for i, c := range s {
+			if c < 32 && (mode&Sanitize == 0 || (c != '\t' && c != '\n' && c != '\r')) {
+				c = ' '
+			}
+			clean[i] = c
+		}
+		s = clean
+	}
+	if mode&SkipStartWhitespaces != 0 {
+		s = bytes.TrimLeft(s, " \t\n\r")
+	}
+	return string(s)
+}
+
+// Raw reads n bytes as they are. The result shares storage with the data u
+// reads.
+func (u *Unpacker) Raw(n int) []byte {
+	if u.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(u.data)-u.pos {
+		u.fail(fmt.Errorf("%w: %d raw bytes at offset %d, %d left", ErrInvalidMessage, n, u.pos, len(u.data)-u.pos))
+		return nil
+	}
+	raw := u.data[u.pos : u.pos+n : u.pos+n]
+	u.pos += n
+	return raw
+}
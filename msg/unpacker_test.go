@@ -0,0 +1,97 @@
+package msg
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUnpackerString(t *testing.T) {
+	data := []byte(" \tname\x01\x1b[31m\n\x00")
+	table := []struct {
+		mode StringMode
+		want string
+	}{
+		{0, " \tname\x01\x1b[31m\n"},
+		{Sanitize, " \tname  [31m\n"},
+		{SanitizeCC, "  name  [31m "},
+		{Sanitize | SanitizeCC, " \tname  [31m\n"},
+		{SkipStartWhitespaces, "name\x01\x1b[31m\n"},
+		{SanitizeCC | SkipStartWhitespaces, "name  [31m "},
+	}
+	for _, test := range table {
+		u := NewUnpacker(data)
+		if got := u.String(test.mode); got != test.want || u.Err() != nil {
+			t.Errorf("mode %b: got %q, %v, want %q", test.mode, got, u.Err(), test.want)
+		}
+		if len(u.Rest()) != 0 {
+			t.Errorf("mode %b: %d bytes left", test.mode, len(u.Rest()))
+		}
+	}
+
+	// sanitizing does not write into the message
+	if string(data) != " \tname\x01\x1b[31m\n\x00" {
+		t.Fatalf("data modified: %q", data)
+	}
+}
+
+func TestUnpackerStickyError(t *testing.T) {
+	u := NewUnpacker([]byte{0x05, 'a', 'b'})
+	if v := u.Int(); v != 5 || u.Err() != nil {
+		t.Fatalf("Int = %d, %v", v, u.Err())
+	}
+	if s := u.String(Sanitize); s != "" || !errors.Is(u.Err(), ErrInvalidMessage) {
+		t.Fatalf("unterminated String = %q, %v", s, u.Err())
+	}
+	first := u.Err()
+
+	// everything after the first error reads as zero and keeps that error
+	if raw := u.Raw(1); raw != nil {
+		t.Errorf("Raw after error = %x", raw)
+	}
+	if v := u.Int(); v != 0 {
+		t.Errorf("Int after error = %d", v)
+	}
+	if u.Err() != first {
+		t.Errorf("error replaced by %v", u.Err())
+	}
+
+	u.Reset([]byte{0x01})
+	if v := u.Int(); v != 1 || u.Err() != nil {
+		t.Fatalf("after Reset: %d, %v", v, u.Err())
+	}
+}
+
+func TestUnpackerBounds(t *testing.T) {
+	table := []struct {
+		name string
+		read func(*Unpacker)
+	}{
+		{"int past the end", func(u *Unpacker) { u.Int(); u.Int(); u.Int() }},
+		{"truncated int", func(u *Unpacker) { u.Raw(2); u.Int() }},
+		{"raw past the end", func(u *Unpacker) { u.Raw(4) }},
+		{"negative raw", func(u *Unpacker) { u.Raw(-1) }},
+	}
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			u := NewUnpacker([]byte{0x01, 0x02, 0x80})
+			test.read(u)
+			if !errors.Is(u.Err(), ErrInvalidMessage) {
+				t.Fatalf("err = %v, want ErrInvalidMessage", u.Err())
+			}
+		})
+	}
+
+	var u Unpacker
+	if u.Int(); !errors.Is(u.Err(), ErrInvalidMessage) {
+		t.Fatalf("zero Unpacker: err = %v", u.Err())
+	}
+}
+
+func TestUnpackerRawSharesData(t *testing.T) {
+	data := []byte{1, 2, 3}
+	u := NewUnpacker(data)
+	raw := u.Raw(2)
+	if len(raw) != 2 || cap(raw) != 2 || &raw[0] != &data[0] {
+		t.Fatalf("Raw = %x (cap %d), want a view of data", raw, cap(raw))
+	}
+}
@@ -0,0 +1,119 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// concatMessages compresses every payload and puts the streams back to back.
+func concatMessages(t *testing.T, payloads [][]byte) (archive, plain []byte) {
+	t.Helper()
+	for _, p := range payloads {
+		c, err := Compress(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		archive = append(archive, c...)
+		plain = append(plain, p...)
+	}
+	return archive, plain
+}
+
+func testMessages() [][]byte {
+	return [][]byte{
+		[]byte("hello world"),
+		nil,
+		snapshotLike(35, 1400),
+		{0x00},
+		randomBytes(35, 300),
+		[]byte("bye"),
+	}
+}
+
+func TestReaderMultistream(t *testing.T) {
+	archive, plain := concatMessages(t, testMessages())
+	for _, size := range []int{1, 7, 64, 4096} {
+		r := NewReader(bytes.NewReader(archive), WithMultistream(true), WithBufferSize(16))
+		got, err := readWithBuffer(r, size)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("size %d: multistream read = %d bytes, %v, want %d bytes", size, len(got), err, len(plain))
+		}
+		if n, err := r.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+			t.Fatalf("size %d: Read after the end = (%d, %v), want (0, io.EOF)", size, n, err)
+		}
+	}
+
+	// without multistream only the first message is read
+	got, err := io.ReadAll(NewReader(bytes.NewReader(archive)))
+	if err != nil || string(got) != "hello world" {
+		t.Fatalf("single stream read = %q, %v", got, err)
+	}
+
+	// a message cut short is an error, not the end
+	r := NewReader(bytes.NewReader(archive[:len(archive)-1]), WithMultistream(true))
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrHuffmanDecompress) {
+		t.Fatalf("truncated archive error = %v, want ErrHuffmanDecompress", err)
+	}
+}
+
+func TestReaderNext(t *testing.T) {
+	messages := testMessages()
+	archive, _ := concatMessages(t, messages)
+
+	r := NewReader(bytes.NewReader(archive))
+	if err := r.Next(); !errors.Is(err, ErrHuffmanDecompress) {
+		t.Fatalf("Next before the end error = %v, want ErrHuffmanDecompress", err)
+	}
+	for i, want := range messages {
+		if i > 0 {
+			if err := r.Next(); err != nil {
+				t.Fatalf("message %d: Next: %v", i, err)
+			}
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("message %d = %d bytes, %v, want %d bytes", i, len(got), err, len(want))
+		}
+		c, _ := Compress(want)
+		if tr := r.Trailer(); tr.Consumed != int64(len(c)) {
+			t.Fatalf("message %d: trailer consumed %d bytes, want %d", i, tr.Consumed, len(c))
+		}
+	}
+	if err := r.Next(); err != io.EOF {
+		t.Fatalf("Next after the last message = %v, want io.EOF", err)
+	}
+}
+
+func TestReaderMultistreamPerMessage(t *testing.T) {
+	first := snapshotLike(36, 100)
+	archive, plain := concatMessages(t, [][]byte{first, first, first})
+
+	// the limit applies to each message
+	r := NewReader(bytes.NewReader(archive), WithMultistream(true), WithOutputLimit(100))
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("multistream read at the limit = %d bytes, %v", len(got), err)
+	}
+	r = NewReader(bytes.NewReader(archive), WithMultistream(true), WithOutputLimit(99))
+	if got, err := io.ReadAll(r); !errors.Is(err, ErrOutputLimit) || len(got) != 99 {
+		t.Fatalf("multistream read over the limit = %d bytes, %v, want 99 bytes and ErrOutputLimit", len(got), err)
+	}
+
+	// strict mode judges the padding of each message, not what follows it
+	r = NewReader(bytes.NewReader(archive), WithMultistream(true), WithStrict(true))
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("strict multistream read = %d bytes, %v", len(got), err)
+	}
+	valid, cases := trailerCases(t)
+	for _, c := range cases {
+		if c.name != "dirty padding" {
+			continue
+		}
+		data := append(append([]byte(nil), c.data...), valid...)
+		r = NewReader(bytes.NewReader(data), WithMultistream(true), WithStrict(true))
+		if _, err := io.ReadAll(r); !errors.Is(err, ErrTrailingData) {
+			t.Fatalf("strict multistream read of dirty padding = %v, want ErrTrailingData", err)
+		}
+	}
+}
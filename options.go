@@ -0,0 +1,110 @@
+package huffman
+
+import "errors"
+
+const (
+	// defaultBufSize is the size of the Reader's read-ahead buffer and of the
+	// Writer's staging buffer.
+	defaultBufSize = 2048
+
+	// minBufSize keeps the Writer able to stage a whole 32 bit flush and
+	// matches the smallest buffer bufio accepts.
+	minBufSize = 16
+)
+
+var (
+	// ErrOutputLimit is wrapped by the error returned when a stream would
+	// produce more than the configured output limit, see WithOutputLimit.
+	ErrOutputLimit = errors.New("output limit exceeded")
+)
+
+// Option configures a Huffman, Reader or Writer. Every option is accepted by
+// all three constructors; one that does not apply to a type is ignored.
+type Option func(*options)
+
+type options struct {
+	dict          *Dictionary
+	bufSize       int
+	outputLimit   int64
+	strict        bool
+	legacyPadding bool
+	multistream   bool
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		dict:    DefaultDictionary,
+		bufSize: defaultBufSize,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithDictionary uses d instead of DefaultDictionary.
+func WithDictionary(d *Dictionary) Option {
+	return func(o *options) {
+		o.dict = d
+	}
+}
+
+// WithBufferSize sets the size of the Reader's read-ahead buffer and of the
+// Writer's staging buffer, 2048 bytes by default. Sizes below 16 bytes are
+// raised to 16. Huffman has no buffer and ignores it.
+func WithBufferSize(n int) Option {
+	return func(o *options) {
+		o.bufSize = max(n, minBufSize)
+	}
+}
+
+// WithOutputLimit caps the output of a single stream at n bytes: the
+// decompressed size for decoding, the compressed size for encoding. This is
+// the destination size the reference implementations take, and what keeps a
+// decoder from producing more than a protocol allows for, e.g. NET_MAX_PAYLOAD.
+// Exceeding it is an error wrapping ErrOutputLimit. n <= 0 means no limit,
+// which is the default.
+func WithOutputLimit(n int64) Option {
+	return func(o *options) {
+		o.outputLimit = max(n, 0)
+	}
+}
+
+// WithStrict enables strict decoding, see Huffman.Strict. A Reader in strict
+// mode returns ErrTrailingData instead of io.EOF when the padding bits after
+// the EOF symbol are not zero or further data follows the stream. To tell, it
+// reads its source up to io.EOF after the EOF symbol, so it must not be used
+// on a stream that stays open. Strict mode survives Reset.
+func WithStrict(ok bool) Option {
+	return func(o *options) {
+		o.strict = ok
+	}
+}
+
+// WithLegacyPadding enables teeworlds 0.7 byte-exact encoding, see
+// Huffman.LegacyPadding. A StreamWriter ends its stream that way on Close.
+// The setting survives Reset.
+func WithLegacyPadding(ok bool) Option {
+	return func(o *options) {
+		o.legacyPadding = ok
+	}
+}
+
+// WithMultistream enables multistream mode, in which a Reader treats its
+// source as compressed messages back to back, each starting at the byte
+// boundary after the previous EOF symbol, and reads them as one concatenated
+// stream. Read returns io.EOF once the source ends after a complete message.
+// The output limit and strict mode apply to each message, where strict mode
+// can only judge the padding bits.
+//
+// Messages must not carry the zero byte teeworlds 0.7 appends after a
+// byte-aligned EOF symbol (see Huffman.LegacyPadding): it cannot be told
+// apart from the start of the next message.
+//
+// Multistream mode survives Reset. To see where one message ends and the next
+// begins, leave it off and use Reader.Next instead.
+func WithMultistream(ok bool) Option {
+	return func(o *options) {
+		o.multistream = ok
+	}
+}
@@ -0,0 +1,183 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// readWithBuffer reads r to its end through a buffer of the given size. Unlike
+// io.ReadAll it does not let r see a buffer larger than that.
+func readWithBuffer(r io.Reader, size int) ([]byte, error) {
+	var out []byte
+	buf := make([]byte, size)
+	for {
+		n, err := r.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+	}
+}
+
+func TestOptionsDictionary(t *testing.T) {
+	for _, dc := range testDictionaries() {
+		payload := snapshotLike(71, 700)
+		want, err := NewHuffmanDict(dc.dict).Compress(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		huff := NewHuffman(WithDictionary(dc.dict))
+		got, err := huff.Compress(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: NewHuffman(WithDictionary) output differs from NewHuffmanDict", dc.name)
+		}
+
+		var buf bytes.Buffer
+		if _, err := NewWriter(&buf, WithDictionary(dc.dict)).Write(payload); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Fatalf("%s: NewWriter(WithDictionary) output differs from NewHuffmanDict", dc.name)
+		}
+
+		back, err := io.ReadAll(NewReader(&buf, WithDictionary(dc.dict)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(back, payload) {
+			t.Fatalf("%s: NewReader(WithDictionary) did not round-trip", dc.name)
+		}
+	}
+}
+
+func TestOptionsBufferSize(t *testing.T) {
+	payload := snapshotLike(72, 5000)
+	want, err := Compress(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{-1, 0, 1, 16, 17, 4096} {
+		var buf bytes.Buffer
+		if _, err := NewWriter(&buf, WithBufferSize(size)).Write(payload); err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Fatalf("size %d: Writer output differs from Compress", size)
+		}
+
+		r := NewReader(bytes.NewReader(want), WithBufferSize(size))
+		back, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(back, payload) {
+			t.Fatalf("size %d: Reader did not round-trip", size)
+		}
+	}
+}
+
+func TestOptionsStrictAndLegacyPadding(t *testing.T) {
+	// byte-aligned EOF symbol, see TestDDNetCompat
+	in := make([]byte, 64)
+	in[0] = 0x15
+
+	legacy, err := NewHuffman(WithLegacyPadding(true)).Compress(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := NewWriter(&buf, WithLegacyPadding(true)).Write(in); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), legacy) || legacy[len(legacy)-1] != 0 {
+		t.Fatalf("legacy padding: Compress = %x, Writer = %x, want a trailing zero byte from both", legacy, buf.Bytes())
+	}
+
+	// one zero byte is the legacy form, two are not
+	smuggled := append(legacy, 0)
+	if _, err := NewHuffman(WithStrict(true)).Decompress(smuggled); !errors.Is(err, ErrTrailingData) {
+		t.Fatalf("strict Huffman error = %v, want ErrTrailingData", err)
+	}
+	if _, err := io.ReadAll(NewReader(bytes.NewReader(smuggled), WithStrict(true))); !errors.Is(err, ErrTrailingData) {
+		t.Fatalf("strict Reader error = %v, want ErrTrailingData", err)
+	}
+	if _, err := NewHuffman(WithStrict(true)).Decompress(legacy); err != nil {
+		t.Fatalf("strict Huffman rejected the legacy form: %v", err)
+	}
+}
+
+func TestOptionsOutputLimit(t *testing.T) {
+	for _, n := range []int{0, 1, 7, 63, 64, 1000, 5000} {
+		payload := snapshotLike(int64(n), n)
+		compressed, err := Compress(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, limit := range []int{n, n + 1} {
+			huff := NewHuffman(WithOutputLimit(int64(limit)))
+			if got, err := huff.Decompress(compressed); err != nil || !bytes.Equal(got, payload) {
+				t.Fatalf("n=%d limit=%d: Decompress = %d bytes, %v", n, limit, len(got), err)
+			}
+			if _, err := huff.Compress(payload); err != nil && len(compressed) <= limit {
+				t.Fatalf("n=%d limit=%d: Compress: %v", n, limit, err)
+			}
+			for _, size := range []int{1, 7, n + 16} {
+				r := NewReader(bytes.NewReader(compressed), WithOutputLimit(int64(limit)))
+				got, err := readWithBuffer(r, size)
+				if err != nil || !bytes.Equal(got, payload) {
+					t.Fatalf("n=%d limit=%d size=%d: Reader = %d bytes, %v", n, limit, size, len(got), err)
+				}
+			}
+		}
+
+		if n <= 1 {
+			// a limit of zero would mean no limit
+			continue
+		}
+		limit := int64(n - 1)
+		if _, err := NewHuffman(WithOutputLimit(limit)).Decompress(compressed); !errors.Is(err, ErrOutputLimit) || !errors.Is(err, ErrHuffmanDecompress) {
+			t.Fatalf("n=%d: Decompress over the limit error = %v, want ErrOutputLimit", n, err)
+		}
+		for _, size := range []int{1, 7, n + 16} {
+			r := NewReader(bytes.NewReader(compressed), WithOutputLimit(limit))
+			got, err := readWithBuffer(r, size)
+			if !errors.Is(err, ErrOutputLimit) {
+				t.Fatalf("n=%d size=%d: Reader over the limit error = %v, want ErrOutputLimit", n, size, err)
+			}
+			if !bytes.Equal(got, payload[:limit]) {
+				t.Fatalf("n=%d size=%d: Reader returned %d bytes before failing, want the %d allowed", n, size, len(got), limit)
+			}
+		}
+	}
+
+	payload := snapshotLike(73, 1000)
+	compressed, err := Compress(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tight := int64(len(compressed) - 1)
+	if _, err := NewHuffman(WithOutputLimit(tight)).Compress(payload); !errors.Is(err, ErrOutputLimit) || !errors.Is(err, ErrHuffmanCompress) {
+		t.Fatalf("Compress over the limit error = %v, want ErrOutputLimit", err)
+	}
+	var buf bytes.Buffer
+	if n, err := NewWriter(&buf, WithOutputLimit(tight)).Write(payload); n != 0 || !errors.Is(err, ErrOutputLimit) || buf.Len() != 0 {
+		t.Fatalf("Writer over the limit = (%d, %v) with %d bytes written, want (0, ErrOutputLimit) and nothing written", n, err, buf.Len())
+	}
+	if _, err := NewWriter(&buf, WithOutputLimit(tight+1)).Write(payload); err != nil || !bytes.Equal(buf.Bytes(), compressed) {
+		t.Fatalf("Writer at the limit: %v", err)
+	}
+	out, compressedFlag, err := NewHuffman(WithOutputLimit(tight)).CompressIfSmaller(nil, payload)
+	if err != nil || compressedFlag || !bytes.Equal(out, payload) {
+		t.Fatalf("CompressIfSmaller over the limit = (%d bytes, %v, %v), want the raw payload", len(out), compressedFlag, err)
+	}
+}
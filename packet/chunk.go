@@ -0,0 +1,151 @@
+package packet
+
+import (
+	"fmt"
+	"iter"
+)
+
+// MaxSequence is the modulus of chunk sequence numbers and acks, which are
+// 10 bits wide.
+const MaxSequence = 1 << 10
+
+// ChunkFlags are the flags of a chunk header.
+type ChunkFlags uint8
+
+const (
+	// ChunkVital marks a chunk that is delivered reliably and in order. Only
+	// vital chunks carry a sequence number.
+	ChunkVital ChunkFlags = 1 << iota
+	// ChunkResend marks a vital chunk sent again.
+	ChunkResend
+)
+
+// ChunkHeader is the header in front of every chunk of a packet payload.
+type ChunkHeader struct {
+	Flags ChunkFlags
+	// Size is the length of the chunk body in bytes.
+	Size int
+	// Seq is the sequence number of a vital chunk, zero otherwise.
+	Seq int
+}
+
+// Len returns the encoded size of h: three bytes for a vital chunk, two
+// otherwise.
+func (h ChunkHeader) Len() int {
+	if h.Flags&ChunkVital != 0 {
+		return 3
+	}
+	return 2
+}
+
+// maxChunkSize is the largest body the size field of a chunk header can
+// describe: 10 bits in 0.6, 12 bits in 0.7.
+func (v Version) maxChunkSize() int {
+	if v == Version06 {
+		return 1<<10 - 1
+	}
+	return 1<<12 - 1
+}
+
+// AppendChunkHeader appends the encoding of h to dst, the way
+// CNetChunkHeader::Pack of version v does.
+func AppendChunkHeader(v Version, dst []byte, h ChunkHeader) ([]byte, error) {
+	if v != Version06 && v != Version07 {
+		return dst, fmt.Errorf("%w: unknown version %s", ErrInvalidPacket, v)
+	}
+	if h.Size < 0 || h.Size > v.maxChunkSize() {
+		return dst, fmt.Errorf("%w: chunk size %d out of range for %s, maximum is %d", ErrInvalidPacket, h.Size, v, v.maxChunkSize())
+	}
+	if h.Seq < 0 || h.Seq >= MaxSequence {
+		return dst, fmt.Errorf("%w: chunk sequence %d out of range", ErrInvalidPacket, h.Seq)
+	}
+
+	flags := byte(h.Flags&(ChunkVital|ChunkResend)) << 6
+	var b0, b1 byte
+	if v == Version06 {
+		b0 = flags | byte(h.Size>>4)&0x3f
+		b1 = byte(h.Size) & 0x0f
+		if h.Flags&ChunkVital != 0 {
+			b1 |= byte(h.Seq>>2) & 0xf0
+		}
+	} else {
+		b0 = flags | byte(h.Size>>6)&0x3f
+		b1 = byte(h.Size) & 0x3f
+		if h.Flags&ChunkVital != 0 {
+			b1 |= byte(h.Seq>>2) & 0xc0
+		}
+	}
+	if h.Flags&ChunkVital != 0 {
+		return append(dst, b0, b1, byte(h.Seq)), nil
+	}
+	return append(dst, b0, b1), nil
+}
+
+// ParseChunkHeader decodes the chunk header at the start of data, the way
+// CNetChunkHeader::Unpack of version v does, and returns it along with the
+// rest of data. It checks that the header is complete, not that the body of
+// h.Size bytes follows; Chunks does both.
+func ParseChunkHeader(v Version, data []byte) (ChunkHeader, []byte, error) {
+	if v != Version06 && v != Version07 {
+		return ChunkHeader{}, nil, fmt.Errorf("%w: unknown version %s", ErrInvalidPacket, v)
+	}
+	if len(data) < 2 {
+		return ChunkHeader{}, nil, fmt.Errorf("%w: truncated chunk header: %d bytes left", ErrInvalidPacket, len(data))
+	}
+
+	h := ChunkHeader{Flags: ChunkFlags(data[0] >> 6)}
+	var seqHigh int
+	if v == Version06 {
+		h.Size = int(data[0]&0x3f)<<4 | int(data[1]&0x0f)
+		seqHigh = int(data[1]&0xf0) << 2
+	} else {
+		h.Size = int(data[0]&0x3f)<<6 | int(data[1]&0x3f)
+		seqHigh = int(data[1]&0xc0) << 2
+	}
+	if h.Flags&ChunkVital == 0 {
+		return h, data[2:], nil
+	}
+	if len(data) < 3 {
+		return ChunkHeader{}, nil, fmt.Errorf("%w: truncated vital chunk header: %d bytes left", ErrInvalidPacket, len(data))
+	}
+	h.Seq = seqHigh | int(data[2])
+	return h, data[3:], nil
+}
+
+// Chunk is one chunk of a packet payload. Body shares storage with the
+// payload it was read from.
+type Chunk struct {
+	Header ChunkHeader
+	Body   []byte
+}
+
+// Chunks iterates over the chunks of a decompressed payload of version v, as
+// returned by Unpack, until the payload is used up. A header or body that
+// runs past the end of the payload is an error, yielded once as the last pair
+// with a zero Chunk. Whether the number of chunks matches Header.NumChunks is
+// left to the caller.
+func Chunks(v Version, payload []byte) iter.Seq2[Chunk, error] {
+	return func(yield func(Chunk, error) bool) {
+		if v != Version06 && v != Version07 {
+			yield(Chunk{}, fmt.Errorf("%w: unknown version %s", ErrInvalidPacket, v))
+			return
+		}
+		offset := 0
+		for rest := payload; len(rest) > 0; {
+			h, body, err := ParseChunkHeader(v, rest)
+			if err != nil {
+				yield(Chunk{}, fmt.Errorf("%w at offset %d", err, offset))
+				return
+			}
+			if h.Size > len(body) {
+				yield(Chunk{}, fmt.Errorf("%w: chunk at offset %d needs %d bytes, %d left", ErrInvalidPacket, offset, h.Size, len(body)))
+				return
+			}
+			if !yield(Chunk{Header: h, Body: body[:h.Size:h.Size]}, nil) {
+				return
+			}
+			rest = body[h.Size:]
+			offset = len(payload) - len(rest)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package packet
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestAppendChunkHeader(t *testing.T) {
+	table := []struct {
+		name    string
+		version Version
+		header  ChunkHeader
+		want    []byte
+	}{
+		{"0.6 vital", Version06, ChunkHeader{Flags: ChunkVital, Size: 0x3a5, Seq: 0x2c7}, []byte{0x7a, 0xb5, 0xc7}},
+		{"0.6 vital resend", Version06, ChunkHeader{Flags: ChunkVital | ChunkResend, Size: 1, Seq: 1}, []byte{0xc0, 0x01, 0x01}},
+		{"0.6 unreliable", Version06, ChunkHeader{Size: 0x3ff}, []byte{0x3f, 0x0f}},
+		{"0.7 vital", Version07, ChunkHeader{Flags: ChunkVital, Size: 0x3a5, Seq: 0x2c7}, []byte{0x4e, 0xa5, 0xc7}},
+		{"0.7 unreliable", Version07, ChunkHeader{Size: 0xfff}, []byte{0x3f, 0x3f}},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := AppendChunkHeader(test.version, nil, test.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, test.want) {
+				t.Fatalf("got %x, want %x", got, test.want)
+			}
+			if len(got) != test.header.Len() {
+				t.Fatalf("Len = %d, wrote %d", test.header.Len(), len(got))
+			}
+		})
+	}
+
+	for _, h := range []ChunkHeader{{Size: 1 << 10}, {Size: -1}, {Flags: ChunkVital, Seq: MaxSequence}} {
+		if _, err := AppendChunkHeader(Version06, nil, h); !errors.Is(err, ErrInvalidPacket) {
+			t.Errorf("%+v: err = %v, want ErrInvalidPacket", h, err)
+		}
+	}
+}
+
+func TestChunks(t *testing.T) {
+	bodies := [][]byte{[]byte("first"), {}, make([]byte, 300), []byte("last")}
+	headers := []ChunkHeader{
+		{Flags: ChunkVital, Seq: 1},
+		{},
+		{Flags: ChunkVital | ChunkResend, Seq: MaxSequence - 1},
+		{Flags: ChunkVital, Seq: 0x155},
+	}
+
+	for _, v := range []Version{Version06, Version07} {
+		t.Run(v.String(), func(t *testing.T) {
+			b := NewBuilder(v, nil)
+			for i, body := range bodies {
+				if err := b.AddChunk(headers[i], body); err != nil {
+					t.Fatal(err)
+				}
+			}
+			data, err := b.Pack(nil, Header{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			h, payload, err := Unpack(nil, v, nil, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var i int
+			for c, err := range Chunks(v, payload) {
+				if err != nil {
+					t.Fatalf("chunk %d: %v", i, err)
+				}
+				want := headers[i]
+				want.Size = len(bodies[i])
+				if c.Header != want {
+					t.Errorf("chunk %d: header = %+v, want %+v", i, c.Header, want)
+				}
+				if !bytes.Equal(c.Body, bodies[i]) {
+					t.Errorf("chunk %d: body = %q, want %q", i, c.Body, bodies[i])
+				}
+				i++
+			}
+			if i != h.NumChunks || i != len(bodies) {
+				t.Fatalf("got %d chunks, header says %d, want %d", i, h.NumChunks, len(bodies))
+			}
+		})
+	}
+}
+
+func TestChunksInvalid(t *testing.T) {
+	table := []struct {
+		name    string
+		version Version
+		payload []byte
+		valid   int // chunks yielded before the error
+	}{
+		{"unknown version", Version(5), []byte{0x00, 0x00}, 0},
+		{"one byte", Version06, []byte{0x00}, 0},
+		{"truncated vital header", Version07, []byte{0x40, 0x01}, 0},
+		{"body past the end", Version06, []byte{0x00, 0x05, 'a', 'b'}, 0},
+		{"0.7 size bits", Version07, []byte{0x01, 0x00, 'a'}, 0},
+		{"second chunk truncated", Version06, []byte{0x00, 0x01, 'a', 0x40, 0x02, 0x00, 'b'}, 1},
+		{"trailing byte", Version07, []byte{0x00, 0x01, 'a', 0x00}, 1},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			var valid int
+			var last error
+			for c, err := range Chunks(test.version, test.payload) {
+				if err != nil {
+					if c.Body != nil || c.Header != (ChunkHeader{}) {
+						t.Errorf("error yielded with chunk %+v", c)
+					}
+					last = err
+					continue
+				}
+				if last != nil {
+					t.Fatalf("chunk yielded after error %v", last)
+				}
+				valid++
+			}
+			if !errors.Is(last, ErrInvalidPacket) {
+				t.Fatalf("err = %v, want ErrInvalidPacket", last)
+			}
+			if valid != test.valid {
+				t.Fatalf("%d chunks before the error, want %d", valid, test.valid)
+			}
+		})
+	}
+}
+
+func TestChunksBreak(t *testing.T) {
+	payload := []byte{0x00, 0x01, 'a', 0x00, 0x01, 'b', 0xff}
+	for c, err := range Chunks(Version06, payload) {
+		if err != nil || string(c.Body) != "a" {
+			t.Fatalf("chunk %+v, err %v", c, err)
+		}
+		break
+	}
+}
+
+func TestChunkBodyCapacity(t *testing.T) {
+	payload := []byte{0x00, 0x01, 'a', 0x00, 0x01, 'b'}
+	for c, err := range Chunks(Version06, payload) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		// appending to a body must not overwrite the next chunk
+		_ = append(c.Body, 'x')
+	}
+	if payload[3] != 0x00 {
+		t.Fatalf("payload modified: %x", payload)
+	}
+}
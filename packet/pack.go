@@ -0,0 +1,160 @@
+package packet
+
+import (
+	"fmt"
+
+	"github.com/teeworlds-go/huffman/v2"
+)
+
+// Pack appends a packet of version v with header h and payload to dst, the
+// way CNetBase::SendPacket does. The payload is compressed with huff only if
+// that makes it smaller, and FlagCompression in the written header says which
+// one it got, whatever h.Flags had. A nil huff uses the default teeworlds
+// dictionary.
+//
+// Control packets are never compressed, as 0.7 rejects compressed ones. For a
+// connless packet only h.Token and h.ResponseToken are used, and only by 0.7.
+func Pack(huff *huffman.Huffman, v Version, dst []byte, h Header, payload []byte) ([]byte, error) {
+	if v != Version06 && v != Version07 {
+		return dst, fmt.Errorf("%w: unknown version %s", ErrInvalidPacket, v)
+	}
+	if huff == nil {
+		huff = &defaultHuffman
+	}
+
+	if h.Flags&FlagConnless != 0 {
+		size := connlessHeaderSize06
+		if v == Version07 {
+			size = connlessHeaderSize07
+		}
+		if size+len(payload) > MaxPacketSize {
+			return dst, fmt.Errorf("%w: connless payload of %d bytes exceeds the maximum packet size of %d", ErrInvalidPacket, len(payload), MaxPacketSize)
+		}
+		if v == Version06 {
+			dst = append(dst, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+		} else {
+			dst = append(dst, byte(FlagConnless)<<2|connlessVersion07)
+			dst = appendBE32(dst, h.Token)
+			dst = appendBE32(dst, h.ResponseToken)
+		}
+		return append(dst, payload...), nil
+	}
+
+	if len(payload) > v.maxPayload() {
+		return dst, fmt.Errorf("%w: payload of %d bytes exceeds the maximum of %d for %s", ErrInvalidPacket, len(payload), v.maxPayload(), v)
+	}
+	if h.Ack < 0 || h.Ack >= MaxSequence {
+		return dst, fmt.Errorf("%w: ack %d out of range", ErrInvalidPacket, h.Ack)
+	}
+	if h.NumChunks < 0 || h.NumChunks > 0xff {
+		return dst, fmt.Errorf("%w: %d chunks do not fit the header", ErrInvalidPacket, h.NumChunks)
+	}
+
+	start := len(dst)
+	flags := h.Flags & (FlagControl | FlagResend)
+	ack := byte(h.Ack>>8) & 0x3
+	if v == Version06 {
+		dst = append(dst, byte(flags)<<4|ack, byte(h.Ack), byte(h.NumChunks))
+	} else {
+		dst = append(dst, byte(flags)<<2|ack, byte(h.Ack), byte(h.NumChunks))
+		dst = appendBE32(dst, h.Token)
+	}
+
+	if flags&FlagControl != 0 {
+		return append(dst, payload...), nil
+	}
+	out, compressed, err := huff.CompressIfSmaller(dst, payload)
+	if err != nil {
+		return dst[:start], fmt.Errorf("%w: payload: %w", ErrInvalidPacket, err)
+	}
+	if compressed {
+		if v == Version06 {
+			out[start] |= byte(FlagCompression) << 4
+		} else {
+			out[start] |= byte(FlagCompression) << 2
+		}
+	}
+	return out, nil
+}
+
+// Builder collects chunks into the payload of a packet, keeping it within
+// MaxPayload, one byte less for 0.7, and packs them with Pack. The zero value
+// is not usable; create one with NewBuilder.
+type Builder struct {
+	v       Version
+	huff    *huffman.Huffman
+	payload []byte
+	chunks  int
+}
+
+// NewBuilder creates a Builder for packets of version v, compressed with huff
+// or, if huff is nil, with the default teeworlds dictionary.
+func NewBuilder(v Version, huff *huffman.Huffman) *Builder {
+	return &Builder{
+		v:       v,
+		huff:    huff,
+		payload: make([]byte, 0, v.maxPayload()),
+	}
+}
+
+// Len returns the size of the payload collected so far.
+func (b *Builder) Len() int {
+	return len(b.payload)
+}
+
+// NumChunks returns the number of chunks collected so far.
+func (b *Builder) NumChunks() int {
+	return b.chunks
+}
+
+// Fits reports whether a chunk with the given flags and a body of n bytes can
+// still be added. When it cannot, the chunks so far are to be packed and the
+// chunk added to the next packet.
+func (b *Builder) Fits(flags ChunkFlags, n int) bool {
+	h := ChunkHeader{Flags: flags, Size: n}
+	return n >= 0 && n <= b.v.maxChunkSize() && b.chunks < 0xff &&
+		len(b.payload)+h.Len()+n <= b.v.maxPayload()
+}
+
+// AddChunk appends a chunk with header h and the given body. h.Size is taken
+// from len(body). It fails, leaving the Builder unchanged, if the chunk does
+// not fit; see Fits.
+func (b *Builder) AddChunk(h ChunkHeader, body []byte) error {
+	h.Size = len(body)
+	if !b.Fits(h.Flags, h.Size) {
+		return fmt.Errorf("%w: chunk of %d bytes does not fit, %d of %d payload bytes and %d chunks used", ErrInvalidPacket, h.Size, len(b.payload), b.v.maxPayload(), b.chunks)
+	}
+	payload, err := AppendChunkHeader(b.v, b.payload, h)
+	if err != nil {
+		return err
+	}
+	b.payload = append(payload, body...)
+	b.chunks++
+	return nil
+}
+
+// Pack appends a packet of the collected chunks to dst, with the flags, ack
+// and token of h, and resets the Builder. Its NumChunks is the number of chunks
+// added. Control and connless packets carry no chunks; send those with Pack.
+func (b *Builder) Pack(dst []byte, h Header) ([]byte, error) {
+	if h.Flags&(FlagControl|FlagConnless) != 0 {
+		return dst, fmt.Errorf("%w: control and connless packets carry no chunks", ErrInvalidPacket)
+	}
+	h.NumChunks = b.chunks
+	out, err := Pack(b.huff, b.v, dst, h, b.payload)
+	if err != nil {
+		return out, err
+	}
+	b.Reset()
+	return out, nil
+}
+
+// Reset discards the collected chunks.
+func (b *Builder) Reset() {
+	b.payload = b.payload[:0]
+	b.chunks = 0
+}
+
+func appendBE32(dst []byte, v uint32) []byte {
+	return append(dst, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
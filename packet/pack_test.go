@@ -0,0 +1,205 @@
+package packet
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/teeworlds-go/huffman/v2"
+)
+
+func TestPackReproducesCapture(t *testing.T) {
+	// the capture comes from a 0.7 server, which writes the legacy trailer
+	huff := huffman.NewHuffman(huffman.WithLegacyPadding(true))
+	h := Header{Flags: FlagCompression, Ack: 0x125, NumChunks: 1, Token: 0xdeadbeef}
+
+	got, err := Pack(huff, Version07, nil, h, realSnap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := join([]byte{0x21, 0x25, 0x01, 0xde, 0xad, 0xbe, 0xef}, realSnapCompressed)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Pack = %x\nwant   %x", got, want)
+	}
+}
+
+func TestPackRoundTrip(t *testing.T) {
+	incompressible := make([]byte, MaxPayload)
+	for i := range incompressible {
+		incompressible[i] = byte(i*151 + 7)
+	}
+
+	for _, v := range []Version{Version06, Version07} {
+		table := []struct {
+			name       string
+			header     Header
+			payload    []byte
+			compressed bool
+		}{
+			{"snap", Header{Ack: 17, NumChunks: 1, Token: 0x01020304}, realSnap, true},
+			{"resend", Header{Flags: FlagResend, Ack: MaxSequence - 1, NumChunks: 3}, realSnap, true},
+			{"incompressible", Header{Ack: 512, NumChunks: 1}, incompressible[:64], false},
+			{"compression flag cleared", Header{Flags: FlagCompression}, incompressible[:64], false},
+			{"empty", Header{}, nil, false},
+			{"control", Header{Flags: FlagControl, Token: 7}, make([]byte, 32), false},
+			{"max payload", Header{NumChunks: 1}, make([]byte, v.maxPayload()), true},
+			{"incompressible max payload", Header{NumChunks: 1}, incompressible[:v.maxPayload()], false},
+			{"connless", Header{Flags: FlagConnless, Token: 1, ResponseToken: 2}, []byte("info"), false},
+		}
+
+		for _, test := range table {
+			t.Run(v.String()+"/"+test.name, func(t *testing.T) {
+				data, err := Pack(nil, v, []byte("keep"), test.header, test.payload)
+				if err != nil {
+					t.Fatalf("Pack: %v", err)
+				}
+				if !bytes.HasPrefix(data, []byte("keep")) {
+					t.Fatalf("dst prefix clobbered: %q", data)
+				}
+				data = data[len("keep"):]
+				if len(data) > MaxPacketSize {
+					t.Fatalf("packet of %d bytes", len(data))
+				}
+
+				h, payload, err := Unpack(nil, v, nil, data)
+				if err != nil {
+					t.Fatalf("Unpack: %v", err)
+				}
+				if got := h.Flags&FlagCompression != 0; got != test.compressed {
+					t.Errorf("compressed = %v, want %v", got, test.compressed)
+				}
+				want := test.header
+				want.Flags = want.Flags&^FlagCompression | h.Flags&FlagCompression
+				if want.Flags&FlagConnless != 0 {
+					want = Header{Flags: FlagConnless}
+					if v == Version07 {
+						want.Token, want.ResponseToken = test.header.Token, test.header.ResponseToken
+					}
+				} else if v == Version06 {
+					want.Token = 0
+				}
+				if h != want {
+					t.Errorf("header = %+v, want %+v", h, want)
+				}
+				if !bytes.Equal(payload, test.payload) {
+					t.Errorf("payload = %x, want %x", payload, test.payload)
+				}
+			})
+		}
+	}
+}
+
+func TestPackInvalid(t *testing.T) {
+	table := []struct {
+		name    string
+		version Version
+		header  Header
+		payload []byte
+	}{
+		{"unknown version", Version(5), Header{}, nil},
+		{"payload too large", Version06, Header{}, make([]byte, MaxPayload+1)},
+		{"0.7 payload too large", Version07, Header{}, make([]byte, MaxPacketSize-headerSize07+1)},
+		{"connless too large", Version07, Header{Flags: FlagConnless}, make([]byte, MaxPacketSize-connlessHeaderSize07+1)},
+		{"ack too large", Version07, Header{Ack: MaxSequence}, nil},
+		{"negative ack", Version06, Header{Ack: -1}, nil},
+		{"too many chunks", Version06, Header{NumChunks: 256}, nil},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			dst := []byte("keep")
+			out, err := Pack(nil, test.version, dst, test.header, test.payload)
+			if !errors.Is(err, ErrInvalidPacket) {
+				t.Fatalf("err = %v, want ErrInvalidPacket", err)
+			}
+			if !bytes.Equal(out, dst) {
+				t.Fatalf("dst = %q, want it unchanged", out)
+			}
+		})
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder(Version07, nil)
+	body := make([]byte, 100)
+
+	if err := b.AddChunk(ChunkHeader{Flags: ChunkVital, Seq: 5}, body); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddChunk(ChunkHeader{}, body[:10]); err != nil {
+		t.Fatal(err)
+	}
+	if b.NumChunks() != 2 || b.Len() != 3+len(body)+2+10 {
+		t.Fatalf("NumChunks = %d, Len = %d", b.NumChunks(), b.Len())
+	}
+
+	data, err := b.Pack(nil, Header{Ack: 4, Token: 99})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.NumChunks() != 0 || b.Len() != 0 {
+		t.Fatalf("Pack did not reset the builder")
+	}
+
+	h, payload, err := Unpack(nil, Version07, nil, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Header{Flags: FlagCompression, Ack: 4, NumChunks: 2, Token: 99}
+	if h != want {
+		t.Fatalf("header = %+v, want %+v", h, want)
+	}
+	wantPayload := join([]byte{0x41, 0x24, 0x05}, body, []byte{0x00, 0x0a}, body[:10])
+	if !bytes.Equal(payload, wantPayload) {
+		t.Fatalf("payload = %x, want %x", payload, wantPayload)
+	}
+}
+
+func TestBuilderLimits(t *testing.T) {
+	b := NewBuilder(Version06, nil)
+
+	if err := b.AddChunk(ChunkHeader{}, make([]byte, 1<<10)); !errors.Is(err, ErrInvalidPacket) {
+		t.Fatalf("oversized 0.6 chunk: err = %v", err)
+	}
+
+	chunk := make([]byte, 1000)
+	if err := b.AddChunk(ChunkHeader{Flags: ChunkVital}, chunk); err != nil {
+		t.Fatal(err)
+	}
+	rest := MaxPayload - b.Len() - 2
+	if b.Fits(0, rest+1) {
+		t.Fatalf("Fits(%d) = true past MaxPayload", rest+1)
+	}
+	if err := b.AddChunk(ChunkHeader{}, chunk[:rest+1]); !errors.Is(err, ErrInvalidPacket) {
+		t.Fatalf("err = %v, want ErrInvalidPacket", err)
+	}
+	if b.NumChunks() != 1 {
+		t.Fatalf("failed AddChunk changed the builder")
+	}
+	if err := b.AddChunk(ChunkHeader{}, chunk[:rest]); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != MaxPayload {
+		t.Fatalf("Len = %d, want %d", b.Len(), MaxPayload)
+	}
+
+	if _, err := b.Pack(nil, Header{Flags: FlagControl}); !errors.Is(err, ErrInvalidPacket) {
+		t.Fatalf("control packet: err = %v", err)
+	}
+	if b.NumChunks() != 2 {
+		t.Fatalf("failed Pack reset the builder")
+	}
+
+	// the 0.7 header is larger, so is a packet of the same payload
+	b = NewBuilder(Version07, nil)
+	rest = MaxPacketSize - headerSize07 - 2
+	if b.Fits(0, rest+1) {
+		t.Fatalf("0.7 Fits(%d) = true past MaxPacketSize", rest+1)
+	}
+	if err := b.AddChunk(ChunkHeader{}, make([]byte, rest)); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := b.Pack(nil, Header{}); err != nil || len(data) > MaxPacketSize {
+		t.Fatalf("0.7 packet of %d bytes: %v", len(data), err)
+	}
+}
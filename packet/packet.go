@@ -0,0 +1,186 @@
+// Package packet reads and writes the header of teeworlds 0.6 and 0.7 network
+// packets and hands out their payload, Huffman decompressed when the header
+// says it is compressed. It follows CNetBase::UnpackPacket and
+// CNetBase::SendPacket of the respective reference implementations.
+package packet
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/teeworlds-go/huffman/v2"
+)
+
+var (
+	ErrInvalidPacket = errors.New("invalid packet")
+)
+
+const (
+	// MaxPacketSize is the largest datagram either protocol version sends.
+	MaxPacketSize = 1400
+	// MaxPayload is the largest payload a packet may carry, also after
+	// decompression. Pack sends one byte less in a 0.7 packet, whose header
+	// would otherwise take it past MaxPacketSize.
+	MaxPayload = 1394
+)
+
+// Version selects the header layout of a packet.
+type Version int
+
+const (
+	Version06 Version = 6
+	Version07 Version = 7
+)
+
+func (v Version) String() string {
+	switch v {
+	case Version06:
+		return "0.6"
+	case Version07:
+		return "0.7"
+	}
+	return fmt.Sprintf("Version(%d)", int(v))
+}
+
+// Header sizes of the two versions, for packets with and without a
+// connection.
+const (
+	headerSize06         = 3
+	connlessHeaderSize06 = 6
+	headerSize07         = 7
+	connlessHeaderSize07 = 9
+
+	// connlessVersion07 is the protocol version 0.7 stores in the low bits
+	// of the first byte of a connless packet.
+	connlessVersion07 = 1
+)
+
+// maxPayload is the largest payload a packet of version v can carry without
+// exceeding MaxPacketSize, even if it does not compress.
+func (v Version) maxPayload() int {
+	if v == Version07 {
+		return MaxPacketSize - headerSize07
+	}
+	return MaxPayload
+}
+
+// Flags are the packet flags. Both versions use the same values, they only
+// place them differently in the first header byte.
+type Flags uint8
+
+const (
+	FlagControl Flags = 1 << iota
+	FlagConnless
+	FlagResend
+	FlagCompression
+)
+
+// Header is the decoded header of a packet.
+type Header struct {
+	Flags Flags
+	// Ack is the sequence number of the last vital chunk received, 10 bits.
+	Ack int
+	// NumChunks is the number of chunks in the payload.
+	NumChunks int
+	// Token is the 0.7 token of the connection, or for a 0.7 connless packet
+	// the token of its receiver. Always zero for 0.6.
+	Token uint32
+	// ResponseToken is the token of the sender of a 0.7 connless packet.
+	ResponseToken uint32
+}
+
+// ParseHeader decodes the header at the start of data and returns it along
+// with the payload following it, which is still compressed if the header has
+// FlagCompression. The payload shares storage with data.
+//
+// Connless packets are reported with Flags set to just FlagConnless and zero
+// Ack and NumChunks, like the reference implementations do for 0.7. Their
+// payload is never compressed.
+func ParseHeader(v Version, data []byte) (Header, []byte, error) {
+	var h Header
+	if len(data) > MaxPacketSize {
+		return h, nil, fmt.Errorf("%w: %d bytes exceed the maximum packet size of %d", ErrInvalidPacket, len(data), MaxPacketSize)
+	}
+
+	switch v {
+	case Version06:
+		if len(data) < headerSize06 {
+			return h, nil, fmt.Errorf("%w: %d bytes are too short for a %s header", ErrInvalidPacket, len(data), v)
+		}
+		// The low nibble of the first byte holds the top of the ack; ddnet
+		// keeps its own flags in the upper two bits of that nibble.
+		h.Flags = Flags(data[0] >> 4)
+		if h.Flags&FlagConnless != 0 {
+			if len(data) < connlessHeaderSize06 {
+				return Header{}, nil, fmt.Errorf("%w: %d bytes are too short for a %s connless header", ErrInvalidPacket, len(data), v)
+			}
+			return Header{Flags: FlagConnless}, data[connlessHeaderSize06:], nil
+		}
+		h.Ack = int(data[0]&0x3)<<8 | int(data[1])
+		h.NumChunks = int(data[2])
+		return h, data[headerSize06:], nil
+
+	case Version07:
+		if len(data) < headerSize07 {
+			return h, nil, fmt.Errorf("%w: %d bytes are too short for a %s header", ErrInvalidPacket, len(data), v)
+		}
+		h.Flags = Flags(data[0] >> 2)
+		if h.Flags&FlagConnless != 0 {
+			if len(data) < connlessHeaderSize07 {
+				return Header{}, nil, fmt.Errorf("%w: %d bytes are too short for a %s connless header", ErrInvalidPacket, len(data), v)
+			}
+			if version := data[0] & 0x3; version != connlessVersion07 {
+				return Header{}, nil, fmt.Errorf("%w: connless packet of version %d, want %d", ErrInvalidPacket, version, connlessVersion07)
+			}
+			return Header{
+				Flags:         FlagConnless,
+				Token:         be32(data[1:]),
+				ResponseToken: be32(data[5:]),
+			}, data[connlessHeaderSize07:], nil
+		}
+		if h.Flags&(FlagControl|FlagCompression) == FlagControl|FlagCompression {
+			return Header{}, nil, fmt.Errorf("%w: compressed control packet", ErrInvalidPacket)
+		}
+		h.Ack = int(data[0]&0x3)<<8 | int(data[1])
+		h.NumChunks = int(data[2])
+		h.Token = be32(data[3:])
+		return h, data[headerSize07:], nil
+	}
+	return h, nil, fmt.Errorf("%w: unknown version %s", ErrInvalidPacket, v)
+}
+
+// Unpack decodes the packet in data and appends its payload to dst,
+// decompressed with huff if the header has FlagCompression. A nil huff uses
+// the default teeworlds dictionary. The decompressed payload may not exceed
+// MaxPayload, nor a smaller huff.OutputLimit.
+func Unpack(huff *huffman.Huffman, v Version, dst, data []byte) (Header, []byte, error) {
+	h, payload, err := ParseHeader(v, data)
+	if err != nil {
+		return h, dst, err
+	}
+	if h.Flags&FlagCompression == 0 {
+		return h, append(dst, payload...), nil
+	}
+
+	dec := defaultHuffman
+	if huff != nil {
+		dec = *huff
+	}
+	if dec.OutputLimit <= 0 || dec.OutputLimit > MaxPayload {
+		dec.OutputLimit = MaxPayload
+	}
+	out, err := dec.DecompressTo(dst, payload)
+	if err != nil {
+		return h, dst, fmt.Errorf("%w: payload: %w", ErrInvalidPacket, err)
+	}
+	return h, out, nil
+}
+
+// defaultHuffman serves Unpack and Pack when no Huffman is given. It is never
+// modified.
+var defaultHuffman = *huffman.NewHuffman()
+
+func be32(b []byte) uint32 {
+	_ = b[3]
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3])
+}
@@ -0,0 +1,185 @@
+package packet
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/teeworlds-go/huffman/v2"
+)
+
+// realSnapCompressed is a single-part snapshot payload as captured from a 0.7
+// server, realSnap its decompressed form.
+// https://github.com/ChillerDragon/huffman-tw/blob/46f419467bc7ea776074e2b3f1b332d89a9cdf9e/spec/03_real_traffic.rb#L30-L40
+var (
+	realSnapCompressed = []byte{
+		0x7d, 0x8d, 0x29, 0x15, 0xa8, 0x2b, 0xf4, 0xd9, 0xc7, 0x9e, 0xad, 0x2d, 0xda, 0x8c, 0xf5, 0x35,
+		0x22, 0xac, 0xaf, 0xa3, 0x1f, 0xb4, 0x07, 0xe2, 0x4a, 0xc3, 0xfa, 0x3a, 0x9a, 0xd4, 0xbe, 0xbe,
+		0x1e, 0xef, 0x9f, 0xac, 0xb8, 0x01,
+	}
+	realSnap = []byte{
+		0x00, 0x36, 0x11, 0x9a, 0x01, 0x9b, 0x01, 0xa2, 0x9d, 0x04, 0x2d, 0x00, 0x03, 0x00, 0x06, 0x00,
+		0x00, 0x01, 0x00, 0x0a, 0x00, 0x84, 0x01, 0xb0, 0xe6, 0x01, 0x91, 0x26, 0x00, 0x80, 0x02, 0x00,
+		0x00, 0x00, 0x40, 0x00, 0x00, 0xb0, 0xe6, 0x01, 0x90, 0x26, 0x00, 0x00, 0x0a, 0x00, 0x0a, 0x01,
+		0x00, 0x00, 0x00, 0x0b, 0x00, 0x08, 0x00, 0x00,
+	}
+)
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestUnpack(t *testing.T) {
+	table := []struct {
+		name    string
+		version Version
+		data    []byte
+		want    Header
+		payload []byte
+	}{
+		{
+			name:    "0.6 compressed snap",
+			version: Version06,
+			// flags COMPRESSION, ack 0x125, 1 chunk
+			data:    join([]byte{0x81, 0x25, 0x01}, realSnapCompressed),
+			want:    Header{Flags: FlagCompression, Ack: 0x125, NumChunks: 1},
+			payload: realSnap,
+		},
+		{
+			name:    "0.6 plain",
+			version: Version06,
+			// flags RESEND, ack 0x3ff, 2 chunks
+			data:    []byte{0x43, 0xff, 0x02, 'a', 'b'},
+			want:    Header{Flags: FlagResend, Ack: 0x3ff, NumChunks: 2},
+			payload: []byte("ab"),
+		},
+		{
+			name:    "0.6 ddnet flag bits",
+			version: Version06,
+			// ddnet's token flag sits right below the 0.6 flags
+			data:    []byte{0x1e, 0x07, 0x00},
+			want:    Header{Flags: FlagControl, Ack: 0x207},
+			payload: []byte{},
+		},
+		{
+			name:    "0.6 connless",
+			version: Version06,
+			data:    []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 'g', 'i', 'e', '3'},
+			want:    Header{Flags: FlagConnless},
+			payload: []byte("gie3"),
+		},
+		{
+			name:    "0.7 compressed snap",
+			version: Version07,
+			// flags COMPRESSION, ack 0x125, 1 chunk, token
+			data:    join([]byte{0x21, 0x25, 0x01, 0xde, 0xad, 0xbe, 0xef}, realSnapCompressed),
+			want:    Header{Flags: FlagCompression, Ack: 0x125, NumChunks: 1, Token: 0xdeadbeef},
+			payload: realSnap,
+		},
+		{
+			name:    "0.7 control",
+			version: Version07,
+			// flags CONTROL, NET_CTRLMSG_KEEPALIVE
+			data:    []byte{0x04, 0x00, 0x00, 0x12, 0x34, 0x56, 0x78, 0x00},
+			want:    Header{Flags: FlagControl, Token: 0x12345678},
+			payload: []byte{0x00},
+		},
+		{
+			name:    "0.7 connless",
+			version: Version07,
+			data:    []byte{0x09, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 'i', 'n', 'f'},
+			want:    Header{Flags: FlagConnless, Token: 0x01020304, ResponseToken: 0x05060708},
+			payload: []byte("inf"),
+		},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			prefix := []byte("keep")
+			h, out, err := Unpack(nil, test.version, prefix, test.data)
+			if err != nil {
+				t.Fatalf("Unpack: %v", err)
+			}
+			if h != test.want {
+				t.Errorf("header = %+v, want %+v", h, test.want)
+			}
+			if !bytes.Equal(out[:len(prefix)], prefix) {
+				t.Errorf("dst prefix clobbered: %q", out[:len(prefix)])
+			}
+			if got := out[len(prefix):]; !bytes.Equal(got, test.payload) {
+				t.Errorf("payload = %x, want %x", got, test.payload)
+			}
+		})
+	}
+}
+
+func TestParseHeaderKeepsPayloadCompressed(t *testing.T) {
+	data := join([]byte{0x81, 0x25, 0x01}, realSnapCompressed)
+	h, payload, err := ParseHeader(Version06, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Flags&FlagCompression == 0 {
+		t.Fatalf("flags = %v, want compression", h.Flags)
+	}
+	if !bytes.Equal(payload, realSnapCompressed) {
+		t.Fatalf("payload = %x, want %x", payload, realSnapCompressed)
+	}
+}
+
+func TestUnpackInvalid(t *testing.T) {
+	overlong, err := huffman.Compress(make([]byte, MaxPayload+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := []struct {
+		name    string
+		version Version
+		data    []byte
+	}{
+		{"empty", Version06, nil},
+		{"0.6 short", Version06, []byte{0x00, 0x00}},
+		{"0.6 short connless", Version06, []byte{0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"0.7 short", Version07, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{"0.7 short connless", Version07, []byte{0x09, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07}},
+		{"0.7 connless bad version", Version07, []byte{0x0a, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}},
+		{"0.7 compressed control", Version07, []byte{0x24, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
+		{"too large", Version06, make([]byte, MaxPacketSize+1)},
+		{"unknown version", Version(5), []byte{0x00, 0x00, 0x00}},
+		{"truncated payload", Version06, join([]byte{0x80, 0x00, 0x00}, realSnapCompressed[:5])},
+		{"payload over MaxPayload", Version06, join([]byte{0x80, 0x00, 0x00}, overlong)},
+	}
+
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			dst := []byte("keep")
+			_, out, err := Unpack(nil, test.version, dst, test.data)
+			if !errors.Is(err, ErrInvalidPacket) {
+				t.Fatalf("err = %v, want ErrInvalidPacket", err)
+			}
+			if !bytes.Equal(out, dst) {
+				t.Fatalf("dst = %q, want it unchanged", out)
+			}
+		})
+	}
+}
+
+func TestUnpackHuffmanLimit(t *testing.T) {
+	data := join([]byte{0x81, 0x25, 0x01}, realSnapCompressed)
+
+	huff := huffman.NewHuffman(huffman.WithOutputLimit(int64(len(realSnap) - 1)))
+	_, _, err := Unpack(huff, Version06, nil, data)
+	if !errors.Is(err, huffman.ErrOutputLimit) {
+		t.Fatalf("err = %v, want ErrOutputLimit", err)
+	}
+
+	// a larger limit does not lift MaxPayload, and huff is left alone
+	huff.OutputLimit = 1 << 20
+	if _, _, err = Unpack(huff, Version06, nil, data); err != nil {
+		t.Fatal(err)
+	}
+	if huff.OutputLimit != 1<<20 {
+		t.Fatalf("OutputLimit changed to %d", huff.OutputLimit)
+	}
+}
@@ -0,0 +1,83 @@
+package huffman
+
+import (
+	"io"
+	"sync"
+)
+
+var (
+	readerPool sync.Pool // *Reader with a defaultBufSize buffer
+	writerPool sync.Pool // *Writer with a defaultBufSize buffer
+)
+
+// AcquireReader returns a Reader for r that uses d and is configured by opts,
+// taken from a pool if one is available. It behaves like NewReader with
+// WithDictionary(d), whatever options a pooled Reader had been given before,
+// except that its buffer is always of the default size. Hand it back with
+// ReleaseReader once done, which saves allocating its buffer for every
+// short-lived stream, such as one per datagram.
+func AcquireReader(d *Dictionary, r io.Reader, opts ...Option) *Reader {
+	var o options
+	if len(opts) > 0 {
+		// the options escape, spare the common case the allocation
+		o = newOptions(opts)
+	}
+	h, _ := readerPool.Get().(*Reader)
+	if h == nil {
+		h = NewReader(r)
+	}
+	h.d = d
+	h.strict = o.strict
+	h.limit = o.outputLimit
+	h.multistream = o.multistream
+	h.Reset(r)
+	return h
+}
+
+// ReleaseReader puts r back into the pool AcquireReader takes from, after
+// dropping its references to the source. r must not be used afterwards.
+// Readers made with a buffer size other than the default are not pooled.
+func ReleaseReader(r *Reader) {
+	if r == nil || len(r.buf) != defaultBufSize {
+		return
+	}
+	r.Reset(nil)
+	readerPool.Put(r)
+}
+
+// AcquireWriter returns a Writer for w that uses d and is configured by opts,
+// taken from a pool if one is available. It behaves like NewWriter with
+// WithDictionary(d), whatever options a pooled Writer had been given before,
+// except that its buffer is always of the default size. Hand it back with
+// ReleaseWriter once done.
+func AcquireWriter(d *Dictionary, w io.Writer, opts ...Option) *Writer {
+	var o options
+	if len(opts) > 0 {
+		// the options escape, spare the common case the allocation
+		o = newOptions(opts)
+	}
+	h, _ := writerPool.Get().(*Writer)
+	if h == nil {
+		h = NewWriter(w)
+	}
+	h.d = d
+	h.legacy = o.legacyPadding
+	h.limit = o.outputLimit
+	h.Reset(w)
+	return h
+}
+
+// ReleaseWriter puts w back into the pool AcquireWriter takes from, after
+// dropping its references to the destination. w must not be used afterwards.
+// A Writer whose buffer is not of the default size, because it was made with
+// another size or has grown, gets a buffer of the default size instead.
+func ReleaseWriter(w *Writer) {
+	if w == nil {
+		return
+	}
+	if cap(w.buf) != defaultBufSize {
+		w.buf = make([]byte, 0, defaultBufSize)
+	}
+	w.Reset(nil)
+	writerPool.Put(w)
+}
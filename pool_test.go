@@ -0,0 +1,110 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestPoolResetsState(t *testing.T) {
+	payload := snapshotLike(39, 500)
+	compressed, err := Compress(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReader(bytes.NewReader(compressed), WithStrict(true), WithOutputLimit(1), WithMultistream(true))
+	_, _ = io.ReadAll(r)
+	ReleaseReader(r)
+	if r.src != nil || r.srcErr != nil || r.terminalErr != nil {
+		t.Fatal("ReleaseReader kept references to the source")
+	}
+	for range 3 {
+		r := AcquireReader(DefaultDictionary, bytes.NewReader(compressed))
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, payload) {
+			t.Fatalf("pooled Reader = %d bytes, %v", len(got), err)
+		}
+		ReleaseReader(r)
+	}
+
+	r = AcquireReader(DefaultDictionary, bytes.NewReader(compressed), WithOutputLimit(1))
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrOutputLimit) {
+		t.Fatalf("pooled Reader with an output limit: %v, want ErrOutputLimit", err)
+	}
+	ReleaseReader(r)
+
+	var buf bytes.Buffer
+	w := AcquireWriter(DefaultDictionary, &buf, WithOutputLimit(1))
+	if _, err := w.Write(payload); !errors.Is(err, ErrOutputLimit) {
+		t.Fatalf("pooled Writer with an output limit: %v, want ErrOutputLimit", err)
+	}
+	ReleaseWriter(w)
+	w = NewWriter(&buf, WithLegacyPadding(true), WithOutputLimit(1))
+	ReleaseWriter(w)
+	if w.w != nil {
+		t.Fatal("ReleaseWriter kept a reference to the destination")
+	}
+	for range 3 {
+		buf.Reset()
+		w := AcquireWriter(DefaultDictionary, &buf)
+		if _, err := w.Write(payload); err != nil || !bytes.Equal(buf.Bytes(), compressed) {
+			t.Fatalf("pooled Writer: %v, output differs: %t", err, !bytes.Equal(buf.Bytes(), compressed))
+		}
+		ReleaseWriter(w)
+	}
+
+	// other buffer sizes of a Reader stay out of the pool
+	ReleaseReader(NewReader(nil, WithBufferSize(16)))
+	ReleaseReader(nil)
+	ReleaseWriter(nil)
+
+	// a Writer is pooled with a buffer of the default size, also one made
+	// with another size or whose buffer has grown
+	grown := NewWriter(nil)
+	grown.buf = append(grown.buf, make([]byte, defaultBufSize+1)...)
+	for _, w := range []*Writer{NewWriter(nil, WithBufferSize(16)), grown} {
+		ReleaseWriter(w)
+		if cap(w.buf) != defaultBufSize || len(w.buf) != 0 {
+			t.Fatalf("released Writer has a buffer of %d/%d bytes", len(w.buf), cap(w.buf))
+		}
+	}
+	w = AcquireWriter(DefaultDictionary, &buf)
+	buf.Reset()
+	if _, err := w.Write(payload); err != nil || !bytes.Equal(buf.Bytes(), compressed) {
+		t.Fatalf("pooled Writer: %v, output differs: %t", err, !bytes.Equal(buf.Bytes(), compressed))
+	}
+	ReleaseWriter(w)
+}
+
+func TestPoolAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("sync.Pool drops items at random under the race detector")
+	}
+	compressed, err := Compress(snapshotLike(39, 1400))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := bytes.NewReader(compressed)
+	out := make([]byte, 2048)
+	ReleaseReader(AcquireReader(DefaultDictionary, src))
+	ReleaseWriter(AcquireWriter(DefaultDictionary, io.Discard))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		src.Reset(compressed)
+		r := AcquireReader(DefaultDictionary, src)
+		if _, err := r.Read(out); err != nil && err != io.EOF {
+			t.Fatal(err)
+		}
+		ReleaseReader(r)
+
+		w := AcquireWriter(DefaultDictionary, io.Discard)
+		if _, err := w.Write(out[:100]); err != nil {
+			t.Fatal(err)
+		}
+		ReleaseWriter(w)
+	})
+	if allocs != 0 {
+		t.Fatalf("Acquire/Release allocates %.1f times per run, want 0", allocs)
+	}
+}
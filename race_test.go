@@ -0,0 +1,7 @@
+//go:build race
+
+package huffman
+
+// raceEnabled is set when testing with -race, under which sync.Pool drops
+// items at random and allocation counts of pooled code mean nothing.
+const raceEnabled = true
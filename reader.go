@@ -2,6 +2,8 @@ package huffman
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -13,46 +15,180 @@ var (
 
 type Reader struct {
 	d           *Dictionary
-	br          io.ByteReader
-	bufSize     int
+	src         io.Reader
 	acc         uint64
 	bitCount    uint
-	srcDrained  bool
 	terminalErr error
+
+	// buf holds input read from src, of which buf[pos:end] is not yet in
+	// acc. srcDrained is set once src has nothing more to give, srcErr if
+	// that was due to an error other than io.EOF.
+	buf        []byte
+	pos, end   int
+	srcDrained bool
+	srcErr     error
+
+	// read counts the bytes read from src, so that the position of the EOF
+	// symbol can be reported in trailer.
+	read    int64
+	strict  bool
+	trailer Trailer
+
+	// limit caps the decompressed size of the stream, written counts
+	// towards it and probe is where Read looks at the symbol beyond it.
+	limit   int64
+	written int64
+	probe   [1]byte
+
+	// multistream makes Read carry on with the next message after an EOF
+	// symbol, start is where in the source the current message begins.
+	multistream bool
+	start       int64
+
+	// out is where WriteTo stages its output for other writers than
+	// those it decodes into directly, kept across calls and Reset.
+	out []byte
 }
 
-// New creates a new Reader with the default Teeworlds' dictionary.
-func NewReader(r io.Reader) *Reader {
-	// pass default global dictionary that is used in Teeworlds
-	return NewReaderDict(DefaultDictionary, r)
+// copyBufSize is the size of the buffer WriteTo and Writer.ReadFrom stage
+// data in, the same io.Copy uses.
+const copyBufSize = 32 << 10
+
+// maxEmptyReads is how often in a row src may return no data and no error
+// before the Reader gives up with io.ErrNoProgress, as bufio does.
+const maxEmptyReads = 100
+
+// NewReader creates a new Reader configured by opts, with the default
+// Teeworlds' dictionary unless WithDictionary is given. The Reader reads
+// ahead of what it decodes, into a buffer of the size WithBufferSize sets.
+func NewReader(r io.Reader, opts ...Option) *Reader {
+	o := newOptions(opts)
+
+	h := Reader{
+		d:           o.dict,
+		src:         r,
+		buf:         make([]byte, o.bufSize),
+		strict:      o.strict,
+		limit:       o.outputLimit,
+		multistream: o.multistream,
+	}
+
+	return &h
 }
 
 // NewReaderDict expects a Dictionary (index -> symbol)
 // You can use the default one if you just want to work with Teeworlds' default compression.
 func NewReaderDict(d *Dictionary, r io.Reader) *Reader {
-	var bufSize = 2048
+	return NewReader(r, WithDictionary(d))
+}
 
-	br, ok := r.(io.ByteReader)
-	if !ok {
-		br = bufio.NewReaderSize(r, bufSize)
+// Read decompresses from the underlying reader into 'decompressed' and
+// returns the number of bytes written to it. Once the Huffman EOF symbol has
+// been decoded it returns io.EOF, unless in multistream mode, where io.EOF
+// means that the source has ended after a complete message.
+func (r *Reader) Read(decompressed []byte) (read int, err error) {
+	if r == nil {
+		return 0, fmt.Errorf("%w: reader is nil", ErrHuffmanDecompress)
 	}
+	for {
+		read, err = r.readMessage(decompressed)
+		if err != io.EOF || !r.multistream {
+			return read, err
+		}
+		if !r.next() {
+			return read, r.terminalErr
+		}
+		if read > 0 {
+			return read, nil
+		}
+	}
+}
 
-	h := Reader{
-		d:       d,
-		br:      br,
-		bufSize: bufSize,
+// readMessage is Read confined to the current message.
+func (r *Reader) readMessage(decompressed []byte) (read int, err error) {
+	if r.limit <= 0 {
+		return r.decode(decompressed)
 	}
 
-	return &h
+	remaining := r.limit - r.written
+	if remaining == 0 && len(decompressed) != 0 && r.terminalErr == nil {
+		// The limit has been reached exactly. Only the EOF symbol may follow.
+		if n, err := r.decode(r.probe[:]); n == 0 {
+			return 0, err
+		}
+		r.terminalErr = fmt.Errorf("%w: %w: stream decodes to more than %d bytes", ErrHuffmanDecompress, ErrOutputLimit, r.limit)
+		return 0, r.terminalErr
+	}
+	if int64(len(decompressed)) > remaining {
+		decompressed = decompressed[:remaining]
+	}
+	read, err = r.decode(decompressed)
+	r.written += int64(read)
+	return read, err
 }
 
-// Decompress decompresses 'data' and writes the result into 'decompressed'.
-// The decompressed slice must be preallocated to fit the decompressed data.
-// Read is the size that was decompressed and written into the 'decompressed' slice.
-func (r *Reader) Read(decompressed []byte) (read int, err error) {
+// WriteTo implements io.WriterTo, so io.Copy decodes the stream into w
+// without an intermediate buffer of its own. A *bytes.Buffer or a
+// *bufio.Writer gets the stream decoded straight into its free space; any
+// other writer gets it staged in a buffer that the Reader keeps, which is
+// allocated once rather than on every copy. It returns the number of
+// decompressed bytes written and, like io.Copy, a nil error once the EOF
+// symbol has been reached.
+func (r *Reader) WriteTo(w io.Writer) (written int64, err error) {
 	if r == nil {
 		return 0, fmt.Errorf("%w: reader is nil", ErrHuffmanDecompress)
 	}
+	for {
+		out, err := r.outBuffer(w)
+		if err != nil {
+			return written, err
+		}
+		n, err := r.Read(out)
+		if n > 0 {
+			// for the direct destinations out is their own storage, so
+			// this copies the decoded bytes onto themselves
+			if werr := writeBuffer(w, out[:n]); werr != nil {
+				return written, werr
+			}
+			written += int64(n)
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// outBuffer returns where WriteTo decodes the next part of the stream to: the
+// free space of a *bytes.Buffer or *bufio.Writer destination, the way
+// Writer.writeDirect encodes into it, or else r.out.
+func (r *Reader) outBuffer(w io.Writer) ([]byte, error) {
+	var avail []byte
+	switch out := w.(type) {
+	case *bytes.Buffer:
+		out.Grow(copyBufSize)
+		avail = out.AvailableBuffer()
+	case *bufio.Writer:
+		if out.Available() == 0 {
+			if err := out.Flush(); err != nil {
+				return nil, err
+			}
+		}
+		avail = out.AvailableBuffer()
+	}
+	if cap(avail) > 0 {
+		return avail[:cap(avail)], nil
+	}
+	if r.out == nil {
+		r.out = make([]byte, copyBufSize)
+	}
+	return r.out, nil
+}
+
+// decode is Read without the output limit.
+func (r *Reader) decode(decompressed []byte) (read int, err error) {
 	if len(decompressed) == 0 {
 		if r.terminalErr != nil {
 			return 0, r.terminalErr
@@ -62,106 +198,112 @@ func (r *Reader) Read(decompressed []byte) (read int, err error) {
 	if r.terminalErr != nil {
 		return 0, r.terminalErr
 	}
-	if !r.d.isInitialized() {
-		err = fmt.Errorf("%w: dictionary is nil or uninitialized", ErrHuffmanDecompress)
-		r.terminalErr = err
-		return 0, err
-	}
-	if r.d.maxCodeLen > maxStoredCodeBits {
-		err = fmt.Errorf("%w: dictionary contains %d-bit codes, maximum supported is %d", ErrHuffmanDecompress, r.d.maxCodeLen, maxStoredCodeBits)
+	if err = r.d.usable(ErrHuffmanDecompress); err != nil {
 		r.terminalErr = err
 		return 0, err
 	}
 
 	var (
-		cursor     int
-		lut        = &r.d.decLut
-		nodes      = &r.d.nodes
-		acc        = r.acc
-		bitCount   = r.bitCount
-		srcDrained = r.srcDrained
-		b          byte
+		cursor   int
+		lut      = &r.d.decLut
+		nodes    = &r.d.nodes
+		acc      = r.acc
+		bitCount = r.bitCount
+		maxLen   = max(uint(r.d.maxCodeLen), lookupTableBits)
 	)
 
 	for cursor < len(decompressed) {
-		// Refill to at least 56 bits. Bytes are pulled through io.ByteReader
-		// one at a time and every prefetched bit is retained in Reader state
-		// when the caller's destination fills.
-		for !srcDrained && bitCount <= 56 {
-			b, err = r.br.ReadByte()
-			if err != nil {
-				if errors.Is(err, io.EOF) {
-					srcDrained = true
-					break
+		// Refill to at least 56 bits. As in decompressTo, 8 bytes are loaded
+		// at once while the buffer holds that many and only the whole bytes
+		// consumed are claimed; the bits above bitCount are the bytes at
+		// pos, which the next refill loads again.
+		if r.end-r.pos < 8 && !r.srcDrained {
+			r.fill()
+		}
+		if r.end-r.pos >= 8 {
+			acc |= binary.LittleEndian.Uint64(r.buf[r.pos:]) << bitCount
+			r.pos += int(63-bitCount) >> 3
+			bitCount |= 56
+		} else {
+			for bitCount <= 56 {
+				if r.pos == r.end {
+					if r.srcDrained {
+						break
+					}
+					// src delivers in small pieces
+					r.fill()
+					continue
 				}
-				// unexpected error, abort
-				r.terminalErr = err
-				return cursor, err
+				acc |= uint64(r.buf[r.pos]) << bitCount
+				r.pos++
+				bitCount += 8
+			}
+			if bitCount < maxLen {
+				if r.srcErr != nil {
+					r.terminalErr = r.srcErr
+					return cursor, r.terminalErr
+				}
+				// Input exhausted, decode under full bit-availability
+				// checks. This is what ends a stream without an EOF
+				// symbol with an error.
+				sym, codeLen, err := r.d.decodeSymbol(acc, bitCount)
+				if err != nil {
+					r.terminalErr = err
+					return cursor, err
+				}
+				acc >>= codeLen
+				bitCount -= codeLen
+				if sym == EofSymbol {
+					return cursor, r.endOfStream(acc, bitCount)
+				}
+				decompressed[cursor] = byte(sym)
+				cursor++
+				continue
 			}
-
-			acc |= uint64(b) << bitCount
-			bitCount += 8
 		}
 
-		entry := lut[acc&lookupTableMask]
-		codeLen := uint(entry & lutLenMask)
+		// At least maxLen bits are available, so no single symbol needs a
+		// bounds check, see decompressTo.
+		for bitCount >= maxLen && cursor < len(decompressed) {
+			entry := lut[acc&lookupTableMask]
+			codeLen := uint(entry & lutLenMask)
 
-		if codeLen != 0 {
-			// resolved straight out of the lookup table
-			if codeLen > bitCount {
-				err = fmt.Errorf("%w: truncated stream: need %d bits, have %d", ErrHuffmanDecompress, codeLen, bitCount)
-				r.terminalErr = err
-				return cursor, err
+			if codeLen != 0 {
+				acc >>= codeLen
+				bitCount -= codeLen
+				if entry&lutEOFBit != 0 {
+					return cursor, r.endOfStream(acc, bitCount)
+				}
+				decompressed[cursor] = byte(entry >> lutSymShift)
+				cursor++
+				continue
 			}
-			acc >>= codeLen
-			bitCount -= codeLen
 
-			if entry&lutEOFBit != 0 {
-				r.terminalErr = io.EOF
-				return cursor, io.EOF
-			}
-			decompressed[cursor] = byte(entry >> lutSymShift)
-			cursor++
-			continue
-		}
+			idx := entry >> lutNodeShift
+			acc >>= lookupTableBits
+			bitCount -= lookupTableBits
 
-		// walk the tree bit by bit from where the lookup table landed
-		if bitCount < lookupTableBits {
-			err = fmt.Errorf("%w: truncated stream: need %d bits, have %d", ErrHuffmanDecompress, lookupTableBits, bitCount)
-			r.terminalErr = err
-			return cursor, err
-		}
-		idx := entry >> lutNodeShift
-		acc >>= lookupTableBits
-		bitCount -= lookupTableBits
+			for {
+				idx = uint32(nodes[idx].Leafs[acc&1])
+				acc >>= 1
+				bitCount--
 
-		for {
-			if bitCount == 0 {
-				err = fmt.Errorf("%w: decoding error: symbol not found in tree", ErrHuffmanDecompress)
-				r.terminalErr = err
-				return cursor, err
-			}
-			idx = uint32(nodes[idx].Leafs[acc&1])
-			acc >>= 1
-			bitCount--
-
-			if idx >= uint32(len(nodes)) {
-				err = fmt.Errorf("%w: invalid stream: walked off the tree", ErrHuffmanDecompress)
-				r.terminalErr = err
-				return cursor, err
-			}
-			if nodes[idx].NumBits > 0 {
-				break
+				if idx >= uint32(len(nodes)) {
+					err = fmt.Errorf("%w: invalid stream: walked off the tree", ErrHuffmanDecompress)
+					r.terminalErr = err
+					return cursor, err
+				}
+				if nodes[idx].NumBits != 0 {
+					break
+				}
 			}
-		}
 
-		if idx == EofSymbol {
-			r.terminalErr = io.EOF
-			return cursor, io.EOF
+			if idx == EofSymbol {
+				return cursor, r.endOfStream(acc, bitCount)
+			}
+			decompressed[cursor] = nodes[idx].Symbol
+			cursor++
 		}
-
-		decompressed[cursor] = nodes[idx].Symbol
-		cursor++
 	}
 
 	// The destination filled before the Huffman EOF symbol. Preserve every
@@ -169,22 +311,194 @@ func (r *Reader) Read(decompressed []byte) (read int, err error) {
 	// exactly where this one stopped.
 	r.acc = acc
 	r.bitCount = bitCount
-	r.srcDrained = srcDrained
 	return cursor, nil
 }
 
+// fill reads more input from src into buf, after moving what is left of it
+// to the front. An error ends the input; it is recorded in srcErr and only
+// returned once decoding actually runs out of bits.
+func (r *Reader) fill() {
+	if r.pos > 0 {
+		r.end = copy(r.buf, r.buf[r.pos:r.end])
+		r.pos = 0
+	}
+	for range maxEmptyReads {
+		n, err := r.src.Read(r.buf[r.end:])
+		r.end += n
+		r.read += int64(n)
+		if err != nil {
+			r.srcDrained = true
+			if !errors.Is(err, io.EOF) {
+				r.srcErr = err
+			}
+			return
+		}
+		if n > 0 {
+			return
+		}
+	}
+	r.srcDrained = true
+	r.srcErr = io.ErrNoProgress
+}
+
+// endOfStream records the trailer once the EOF symbol has been decoded, with
+// acc holding the bitCount bits that were read past it, and returns the
+// terminal result of the stream. The whole bytes among those bits are kept,
+// they are where the next message starts.
+func (r *Reader) endOfStream(acc uint64, bitCount uint) error {
+	// the bulk refill leaves unclaimed bits above bitCount
+	acc &= 1<<bitCount - 1
+	pad := bitCount % 8
+	ahead := r.buf[r.pos:r.end]
+	t := Trailer{
+		Consumed:    r.read - int64(len(ahead)) - int64(bitCount/8) - r.start,
+		PaddingBits: int(pad),
+		PaddingZero: acc&(1<<pad-1) == 0,
+		Extra:       int64(bitCount/8) + int64(len(ahead)),
+		ExtraZero:   acc>>pad == 0 && allZero(ahead),
+	}
+	r.acc = acc >> pad
+	r.bitCount = bitCount - pad
+	if r.multistream {
+		// what follows is the next message, only the padding is trailer
+		t.Extra, t.ExtraZero = 0, true
+	}
+	if r.strict && !r.multistream && t.PaddingZero && t.ExtraZero {
+		// Judging what follows means reading the source to its end. Stop at
+		// the first non-zero byte, that is already a verdict.
+		for !r.srcDrained && t.ExtraZero {
+			r.pos = r.end
+			r.fill()
+			t.Extra += int64(r.end)
+			t.ExtraZero = allZero(r.buf[:r.end])
+		}
+		if r.srcErr != nil {
+			r.trailer = t
+			r.terminalErr = r.srcErr
+			return r.terminalErr
+		}
+		// all of it is trailer, none of it a next message
+		r.acc, r.bitCount = 0, 0
+		r.pos, r.end, r.srcDrained = 0, 0, true
+	}
+	r.trailer = t
+	r.terminalErr = io.EOF
+	if r.strict {
+		if err := t.check(); err != nil {
+			r.terminalErr = err
+		}
+	}
+	return r.terminalErr
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Next moves on to the message that follows the one Read has finished with
+// io.EOF, at the byte boundary after its EOF symbol. It returns io.EOF if the
+// source ended there, and the terminal error of the Reader if Read failed.
+// Output limit, trailer and strict mode start over with each message; in
+// strict mode Read judges everything after a message as its trailer, so
+// there is no next message to move on to.
+func (r *Reader) Next() error {
+	if r == nil {
+		return fmt.Errorf("%w: reader is nil", ErrHuffmanDecompress)
+	}
+	if r.terminalErr == nil {
+		return fmt.Errorf("%w: Next before the end of the message", ErrHuffmanDecompress)
+	}
+	if r.terminalErr != io.EOF || !r.next() {
+		return r.terminalErr
+	}
+	return nil
+}
+
+// next starts the message following the EOF symbol endOfStream left off at,
+// if the source holds one.
+func (r *Reader) next() bool {
+	if r.bitCount == 0 && r.pos == r.end {
+		if !r.srcDrained {
+			r.fill()
+		}
+		if r.pos == r.end {
+			if r.srcErr != nil {
+				r.terminalErr = r.srcErr
+			}
+			return false
+		}
+	}
+	r.start = r.read - int64(r.end-r.pos) - int64(r.bitCount/8)
+	r.terminalErr = nil
+	r.trailer = Trailer{}
+	r.written = 0
+	return true
+}
+
+// InputOffset returns the number of bytes of the source the Reader has
+// logically consumed: those holding the codes decoded so far, including a
+// partly consumed byte. Once Read has returned io.EOF, it is the position of
+// the first byte after the stream, and in multistream mode after the current
+// message. The Reader has usually read further ahead than that, see Buffered.
+// A strict Reader reads its source to the end after the EOF symbol and counts
+// all of it as consumed.
+func (r *Reader) InputOffset() int64 {
+	return r.read - int64(r.end-r.pos) - int64(r.bitCount/8)
+}
+
+// Buffered returns the bytes the Reader has read from its source beyond
+// InputOffset. The reader is valid until the next call to Read. Together
+// with the rest of the source, io.MultiReader(r.Buffered(), src), it is what
+// follows the stream, e.g. the uncompressed part of a container. The zero
+// byte teeworlds 0.7 appends after a byte-aligned EOF symbol is not part of
+// the stream and so is among them.
+//
+// In strict mode the Reader reads its source to the end after the EOF
+// symbol, so nothing of what follows is left to return.
+func (r *Reader) Buffered() io.Reader {
+	acc := r.acc >> (r.bitCount % 8)
+	ahead := make([]byte, 0, int(r.bitCount/8)+r.end-r.pos)
+	for range r.bitCount / 8 {
+		ahead = append(ahead, byte(acc))
+		acc >>= 8
+	}
+	return bytes.NewReader(append(ahead, r.buf[r.pos:r.end]...))
+}
+
+// Trailer describes what followed the EOF symbol. It is only meaningful once
+// Read has returned io.EOF, or ErrTrailingData in strict mode. Outside strict
+// mode, Extra only counts the bytes the Reader had already read ahead.
+func (r *Reader) Trailer() Trailer {
+	return r.trailer
+}
+
+// ResetDict is Reset that also replaces the dictionary, e.g. for a pooled
+// Reader serving a connection that negotiated a different one. It checks d
+// first and leaves the Reader unchanged if d cannot be used.
+func (r *Reader) ResetDict(d *Dictionary, rr io.Reader) error {
+	if err := d.usable(ErrHuffmanDecompress); err != nil {
+		return err
+	}
+	r.d = d
+	r.Reset(rr)
+	return nil
+}
+
 func (r *Reader) Reset(rr io.Reader) {
+	r.src = rr
 	r.acc = 0
 	r.bitCount = 0
+	r.pos, r.end = 0, 0
 	r.srcDrained = false
+	r.srcErr = nil
 	r.terminalErr = nil
-
-	// bufio.Reader implements this interface
-	br, ok := rr.(io.ByteReader)
-	if ok {
-		r.br = br
-		return
-	}
-
-	r.br = bufio.NewReaderSize(rr, r.bufSize)
+	r.read = 0
+	r.trailer = Trailer{}
+	r.written = 0
+	r.start = 0
 }
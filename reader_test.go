@@ -2,9 +2,11 @@ package huffman_test
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"reflect"
 	"testing"
+	"testing/iotest"
 
 	"github.com/teeworlds-go/huffman/v2"
 )
@@ -72,8 +74,8 @@ func readTest(t *testing.T, compressed, want []byte) {
 		)
 
 		// we pass a small buffer to io.CopyBuffer to test if the reader is able to handle continuous streams
-		// calling the Read method multiple times
-		written, err := io.CopyBuffer(output, r, smallBuffer)
+		// calling the Read method multiple times; hiding WriteTo makes io.CopyBuffer actually use it
+		written, err := io.CopyBuffer(output, struct{ io.Reader }{r}, smallBuffer)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -87,5 +89,52 @@ func readTest(t *testing.T, compressed, want []byte) {
 		if !reflect.DeepEqual(got, want) {
 			t.Fatalf("got %v, wanted %v", got, want)
 		}
+
+		// and through WriteTo, which decodes straight into output
+		output.Reset()
+		if _, err := io.CopyBuffer(output, huffman.NewReader(bytes.NewReader(compressed)), smallBuffer); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(output.Bytes(), want) {
+			t.Fatalf("WriteTo: got %v, wanted %v", output.Bytes(), want)
+		}
+	}
+}
+
+func TestReaderSourceShapes(t *testing.T) {
+	want := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog "), 50)
+	compressed, err := huffman.Compress(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := map[string]func() io.Reader{
+		"one byte": func() io.Reader { return iotest.OneByteReader(bytes.NewReader(compressed)) },
+		"half":     func() io.Reader { return iotest.HalfReader(bytes.NewReader(compressed)) },
+		"data+EOF": func() io.Reader { return iotest.DataErrReader(bytes.NewReader(compressed)) },
+	}
+	for name, src := range sources {
+		for _, size := range []int{16, 17, 100, 4096} {
+			r := huffman.NewReader(src(), huffman.WithBufferSize(size))
+			got, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, want) {
+				t.Fatalf("%s, buffer %d: read %d bytes, %v", name, size, len(got), err)
+			}
+		}
+	}
+
+	// a source error is reported once decoding runs out of input
+	r := huffman.NewReader(iotest.TimeoutReader(bytes.NewReader(compressed)), huffman.WithBufferSize(64))
+	if _, err := io.ReadAll(r); !errors.Is(err, iotest.ErrTimeout) {
+		t.Fatalf("source error = %v, want iotest.ErrTimeout", err)
+	}
+	r = huffman.NewReader(emptyReader{})
+	if _, err := io.ReadAll(r); !errors.Is(err, io.ErrNoProgress) {
+		t.Fatalf("source without progress error = %v, want io.ErrNoProgress", err)
 	}
 }
+
+// emptyReader returns neither data nor an error.
+type emptyReader struct{}
+
+func (emptyReader) Read([]byte) (int, error) { return 0, nil }
@@ -367,6 +367,72 @@ func TestNilAndZeroValueDictionariesAreRejected(t *testing.T) {
 	}
 }
 
+// TestUnusableDictionaryErrors checks that every entry point rejects an
+// unusable dictionary with the error of Dictionary.usable.
+func TestUnusableDictionaryErrors(t *testing.T) {
+	deep := &Dictionary{}
+	*deep = *DefaultDictionary
+	deep.maxCodeLen = maxStoredCodeBits + 1
+
+	data := []byte("payload")
+	for name, d := range map[string]*Dictionary{"nil": nil, "zero": {}, "deep": deep} {
+		t.Run(name, func(t *testing.T) {
+			huff := NewHuffmanDict(d)
+			var b Batch
+			compress := map[string]func() error{
+				"Compress": func() error { _, err := huff.Compress(data); return err },
+				"CompressIfSmaller": func() error {
+					_, _, err := huff.CompressIfSmaller(nil, data)
+					return err
+				},
+				"CompressBatch":         func() error { return huff.CompressBatch(&b, [][]byte{data}) },
+				"BitWriter.WriteSymbol": func() error { return NewBitWriter(d, nil).WriteSymbol(0) },
+				"Writer.Write": func() error {
+					_, err := NewWriterDict(d, io.Discard).Write(data)
+					return err
+				},
+				"StreamWriter.Write": func() error {
+					_, err := NewStreamWriter(io.Discard, WithDictionary(d)).Write(data)
+					return err
+				},
+			}
+			decompress := map[string]func() error{
+				"Decompress":   func() error { _, err := huff.Decompress(data); return err },
+				"DecompressTo": func() error { _, err := huff.DecompressTo(nil, data); return err },
+				"DecompressTrailer": func() error {
+					_, _, err := huff.DecompressTrailer(nil, data)
+					return err
+				},
+				"DecompressBatch": func() error { return huff.DecompressBatch(&b, [][]byte{data}) },
+				"Symbols": func() error {
+					for _, err := range huff.Symbols(data) {
+						if err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+				"BitReader.ReadSymbol": func() error { _, err := NewBitReader(d, data).ReadSymbol(); return err },
+				"Reader.Read": func() error {
+					_, err := NewReaderDict(d, bytes.NewReader(data)).Read(make([]byte, 1))
+					return err
+				},
+			}
+			for kind, fns := range map[error]map[string]func() error{
+				ErrHuffmanCompress:   compress,
+				ErrHuffmanDecompress: decompress,
+			} {
+				want := d.usable(kind).Error()
+				for name, fn := range fns {
+					if err := fn(); err == nil || err.Error() != want {
+						t.Errorf("%s error = %v, want %q", name, err, want)
+					}
+				}
+			}
+		})
+	}
+}
+
 func TestCopiedDictionaryRemainsUsable(t *testing.T) {
 	dict := *NewDictionary()
 	huff := NewHuffmanDict(&dict)
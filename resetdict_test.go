@@ -0,0 +1,83 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestResetDict(t *testing.T) {
+	payload := snapshotLike(38, 2000)
+	r := NewReader(bytes.NewReader(nil))
+	var out bytes.Buffer
+	w := NewWriter(&out)
+	sw := NewStreamWriter(&out)
+
+	for _, dc := range testDictionaries() {
+		want, err := CompressDict(dc.dict, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out.Reset()
+		if err := w.ResetDict(dc.dict, &out); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(payload); err != nil || !bytes.Equal(out.Bytes(), want) {
+			t.Fatalf("%s: Writer after ResetDict: %v, output differs: %t", dc.name, err, !bytes.Equal(out.Bytes(), want))
+		}
+
+		out.Reset()
+		if err := sw.ResetDict(dc.dict, &out); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sw.Write(payload); err != nil {
+			t.Fatal(err)
+		}
+		if err := sw.Close(); err != nil || !bytes.Equal(out.Bytes(), want) {
+			t.Fatalf("%s: StreamWriter after ResetDict: %v, output differs: %t", dc.name, err, !bytes.Equal(out.Bytes(), want))
+		}
+
+		if err := r.ResetDict(dc.dict, bytes.NewReader(want)); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, payload) {
+			t.Fatalf("%s: Reader after ResetDict = %d bytes, %v", dc.name, len(got), err)
+		}
+	}
+}
+
+func TestResetDictRejects(t *testing.T) {
+	payload := []byte("hello world")
+	compressed, err := Compress(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deep := &Dictionary{}
+	*deep = *DefaultDictionary
+	deep.maxCodeLen = maxStoredCodeBits + 1
+
+	for _, d := range []*Dictionary{nil, {}, deep} {
+		r := NewReader(bytes.NewReader(compressed))
+		if err := r.ResetDict(d, bytes.NewReader(nil)); !errors.Is(err, ErrHuffmanDecompress) {
+			t.Fatalf("Reader.ResetDict error = %v, want ErrHuffmanDecompress", err)
+		}
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, payload) {
+			t.Fatalf("Reader changed by a failed ResetDict: %q, %v", got, err)
+		}
+
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if err := w.ResetDict(d, io.Discard); !errors.Is(err, ErrHuffmanCompress) {
+			t.Fatalf("Writer.ResetDict error = %v, want ErrHuffmanCompress", err)
+		}
+		if _, err := w.Write(payload); err != nil || !bytes.Equal(buf.Bytes(), compressed) {
+			t.Fatalf("Writer changed by a failed ResetDict: %v", err)
+		}
+
+		if err := NewStreamWriter(&buf).ResetDict(d, io.Discard); !errors.Is(err, ErrHuffmanCompress) {
+			t.Fatalf("StreamWriter.ResetDict error = %v, want ErrHuffmanCompress", err)
+		}
+	}
+}
@@ -56,6 +56,13 @@ func TestSizingNeverExceedsLimit32(t *testing.T) {
 				t.Errorf("compressBufSize(%d, %d) = %d bytes, too small for %d bits", n, codeLen, size, need)
 			}
 		}
+
+		if size, ok := decompressBufSize(n, limit32); ok && (size > limit32 || size != uint64(n)*8+8) {
+			t.Errorf("decompressBufSize(%d) = %d, want %d within the 32 bit limit", n, size, uint64(n)*8+8)
+		}
+	}
+	if _, ok := decompressBufSize(math.MaxInt32/8, limit32); ok {
+		t.Error("decompressBufSize accepted an input whose bound cannot be represented on 32 bit")
 	}
 }
 
@@ -93,6 +100,9 @@ func TestSizingDoesNotWrapOn64Bit(t *testing.T) {
 	if size, ok := compressBufSize(maxInt, 255, maxAlloc64); ok {
 		t.Errorf("compressBufSize(MaxInt, 255) = %d, want overflow rejection", size)
 	}
+	if size, ok := decompressBufSize(maxInt, maxAlloc64); ok {
+		t.Errorf("decompressBufSize(MaxInt) = %d, want overflow rejection", size)
+	}
 	if got := growCap(maxInt, maxAlloc64, maxAlloc64); got != maxAlloc64 {
 		t.Errorf("growCap(MaxInt, MaxInt) = %d, want saturated %d", got, maxAlloc64)
 	}
@@ -0,0 +1,77 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// UnmarshalBinary replaces s with the snapshot in data, which holds a
+// CSnapshot the way it sits in memory, as demos store it: little-endian ints
+// of the data size in bytes, the number of items and the offset of each item,
+// followed by the items, each its key and then its fields. The layout is
+// checked as strictly as CSnapshot::IsValid does. On error s is unchanged.
+func (s *Snapshot) UnmarshalBinary(data []byte) error {
+	if len(data) < 8 || len(data)%4 != 0 {
+		return fmt.Errorf("%w: %d bytes are no snapshot", ErrInvalidSnapshot, len(data))
+	}
+	dataSize := int(int32(binary.LittleEndian.Uint32(data)))
+	numItems := int(int32(binary.LittleEndian.Uint32(data[4:])))
+	if numItems < 0 || numItems > MaxItems || dataSize < 0 || dataSize > MaxSize {
+		return fmt.Errorf("%w: %d items of %d bytes", ErrInvalidSnapshot, numItems, dataSize)
+	}
+	if want := 8 + 4*numItems + dataSize; len(data) != want {
+		return fmt.Errorf("%w: %d items of %d bytes take %d bytes, have %d", ErrInvalidSnapshot, numItems, dataSize, want, len(data))
+	}
+	offsets := data[8 : 8+4*numItems]
+	items := data[8+4*numItems:]
+
+	var out Snapshot
+	for i := range numItems {
+		start := int(int32(binary.LittleEndian.Uint32(offsets[4*i:])))
+		end := dataSize
+		if i+1 < numItems {
+			end = int(int32(binary.LittleEndian.Uint32(offsets[4*i+4:])))
+		}
+		if start < 0 || start%4 != 0 || end > dataSize || end-start < 4 || (i == 0 && start != 0) {
+			return fmt.Errorf("%w: item %d spans bytes %d to %d of %d", ErrInvalidSnapshot, i, start, end, dataSize)
+		}
+		key := binary.LittleEndian.Uint32(items[start:])
+		item := Item{Type: int(key >> 16), ID: int(key & 0xffff), Data: make([]int32, (end-start-4)/4)}
+		for j := range item.Data {
+			item.Data[j] = int32(binary.LittleEndian.Uint32(items[start+4+4*j:]))
+		}
+		if err := out.Add(item); err != nil {
+			return err
+		}
+	}
+	if numItems == 0 && dataSize != 0 {
+		return fmt.Errorf("%w: no items in %d bytes", ErrInvalidSnapshot, dataSize)
+	}
+	*s = out
+	return nil
+}
+
+// AppendBinary appends s to b in the layout UnmarshalBinary reads, as the
+// reference demo recorder writes snapshots. It never fails.
+func (s *Snapshot) AppendBinary(b []byte) ([]byte, error) {
+	b = binary.LittleEndian.AppendUint32(b, uint32(s.size))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(s.items)))
+	offset := 0
+	for _, item := range s.items {
+		b = binary.LittleEndian.AppendUint32(b, uint32(offset))
+		offset += 4 + 4*len(item.Data)
+	}
+	for _, item := range s.items {
+		b = binary.LittleEndian.AppendUint32(b, uint32(item.Key()))
+		for _, v := range item.Data {
+			b = binary.LittleEndian.AppendUint32(b, uint32(v))
+		}
+	}
+	return b, nil
+}
+
+// MarshalBinary returns s in the layout UnmarshalBinary reads, see
+// AppendBinary.
+func (s *Snapshot) MarshalBinary() ([]byte, error) {
+	return s.AppendBinary(make([]byte, 0, 8+4*len(s.items)+s.size))
+}
@@ -0,0 +1,107 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// leInts returns vs as little-endian ints, the way a CSnapshot sits in memory.
+func leInts(vs ...int32) []byte {
+	var b []byte
+	for _, v := range vs {
+		b = binary.LittleEndian.AppendUint32(b, uint32(v))
+	}
+	return b
+}
+
+func TestUnmarshalBinary(t *testing.T) {
+	data := leInts(
+		24, 3, // data size, number of items
+		0, 12, 16, // offsets
+		4<<16|2, 1, -3, // type 4, ID 2
+		0x7fff<<16|1, // type 0x7fff, ID 1, no fields
+		9<<16|0, 7,
+	)
+	var s Snapshot
+	if err := s.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	want := []Item{
+		{Type: 4, ID: 2, Data: []int32{1, -3}},
+		{Type: 0x7fff, ID: 1, Data: []int32{}},
+		{Type: 9, ID: 0, Data: []int32{7}},
+	}
+	got := s.Items()
+	if len(got) != len(want) {
+		t.Fatalf("Items = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].Key() != want[i].Key() || !slices.Equal(got[i].Data, want[i].Data) {
+			t.Errorf("item %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	again, err := s.MarshalBinary()
+	if err != nil || !bytes.Equal(again, data) {
+		t.Fatalf("MarshalBinary = %x, %v\nwant            %x", again, err, data)
+	}
+
+	var empty Snapshot
+	if err := empty.UnmarshalBinary(leInts(0, 0)); err != nil || empty.Len() != 0 {
+		t.Fatalf("empty snapshot: Len = %d, err = %v", empty.Len(), err)
+	}
+}
+
+func TestUnmarshalBinaryInvalid(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"short":              leInts(0),
+		"not whole ints":     append(leInts(0, 0), 0),
+		"negative items":     leInts(0, -1),
+		"too many items":     leInts(0, MaxItems+1),
+		"data size too big":  leInts(MaxSize+4, 0),
+		"missing data":       leInts(8, 1, 0, 1<<16),
+		"trailing data":      leInts(4, 1, 0, 1<<16, 0),
+		"data without items": leInts(4, 0, 0),
+		"first offset":       leInts(8, 1, 4, 1<<16, 0),
+		"unaligned offset":   leInts(12, 2, 0, 6, 1<<16, 0, 1<<16|1),
+		"offsets descending": leInts(12, 2, 0, 0, 1<<16, 0, 1<<16|1),
+		"offset past data":   leInts(8, 2, 0, 12, 1<<16, 1<<16|1),
+		"duplicate key":      leInts(8, 2, 0, 4, 1<<16, 1<<16),
+	} {
+		s := Snapshot{}
+		if err := s.Add(Item{Type: 1, ID: 5}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.UnmarshalBinary(data); !errors.Is(err, ErrInvalidSnapshot) {
+			t.Errorf("%s: err = %v, want ErrInvalidSnapshot", name, err)
+		}
+		if _, ok := s.Find(1, 5); !ok || s.Len() != 1 {
+			t.Errorf("%s: failed UnmarshalBinary changed the snapshot", name)
+		}
+	}
+}
+
+func TestMarshalBinaryRandom(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	s := &Snapshot{}
+	for range 50 {
+		s = randomSnapshot(rng, s)
+		data, err := s.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Snapshot
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatal(err)
+		}
+		again, _ := got.MarshalBinary()
+		if !maps.EqualFunc(itemMap(&got), itemMap(s), slices.Equal) || !bytes.Equal(again, data) {
+			t.Fatalf("round trip changed the snapshot")
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package snapshot
+
+import (
+	"fmt"
+
+	"github.com/teeworlds-go/huffman/v2"
+)
+
+// ItemSizes holds the number of fields of item types, indexed by type. A
+// delta leaves out the size of an item whose type has one here and sends it
+// for every other type, such as the extended types of ddnet. Zero and
+// missing entries both mean the size is sent.
+type ItemSizes []int
+
+func (sizes ItemSizes) of(typ int) int {
+	if typ < 0 || typ >= len(sizes) {
+		return 0
+	}
+	return sizes[typ]
+}
+
+// Delta is a decoded snapshot delta.
+type Delta struct {
+	// Deleted are the keys of the items of the base snapshot that are gone.
+	Deleted []int
+	// Updated are the items that changed or appeared. For an item the base
+	// snapshot has, Data holds the difference to it, field by field;
+	// otherwise the item itself.
+	Updated []Item
+	// NumTemp is a count the delta header carries without any use.
+	NumTemp int
+}
+
+// ParseDelta decodes the delta data of a snapshot message, after the parts
+// have been put together: the CVariableInt packed header, deleted keys and
+// updated items of CSnapshotDelta::CreateDelta. sizes gives the item sizes
+// left out of it. Every count and size is checked against what data holds.
+func ParseDelta(data []byte, sizes ItemSizes) (*Delta, error) {
+	r := deltaReader{data: data}
+	numDeleted := int(r.int("number of deleted items"))
+	numUpdated := int(r.int("number of updated items"))
+	numTemp := int(r.int("number of temporary items"))
+	if r.err != nil {
+		return nil, r.err
+	}
+	if numDeleted < 0 || numUpdated < 0 || numTemp < 0 {
+		return nil, fmt.Errorf("%w: negative item count in delta header", ErrInvalidSnapshot)
+	}
+	// every deleted key and updated item takes at least one byte, which
+	// bounds the allocations below by the input
+	if numDeleted > len(data) || numUpdated > len(data) {
+		return nil, fmt.Errorf("%w: delta of %d bytes claims %d deleted and %d updated items", ErrInvalidSnapshot, len(data), numDeleted, numUpdated)
+	}
+
+	d := &Delta{
+		Deleted: make([]int, 0, numDeleted),
+		Updated: make([]Item, 0, numUpdated),
+		NumTemp: numTemp,
+	}
+	for range numDeleted {
+		d.Deleted = append(d.Deleted, int(uint32(r.int("deleted key"))))
+	}
+	for range numUpdated {
+		typ := int(r.int("item type"))
+		id := int(r.int("item ID"))
+		if r.err != nil {
+			return nil, r.err
+		}
+		if typ < 0 || typ > maxTypeID || id < 0 || id > maxTypeID {
+			return nil, fmt.Errorf("%w: item type %d, ID %d out of range", ErrInvalidSnapshot, typ, id)
+		}
+		size := sizes.of(typ)
+		if size == 0 {
+			size = int(r.int("item size"))
+		}
+		// each field takes at least one byte
+		if size < 0 || size > len(data)-r.pos {
+			if r.err != nil {
+				return nil, r.err
+			}
+			return nil, fmt.Errorf("%w: item type %d, ID %d of %d fields at offset %d, %d bytes left", ErrInvalidSnapshot, typ, id, size, r.pos, len(data)-r.pos)
+		}
+		item := Item{Type: typ, ID: id, Data: make([]int32, size)}
+		for i := range item.Data {
+			item.Data[i] = r.int("item field")
+		}
+		d.Updated = append(d.Updated, item)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.pos != len(data) {
+		return nil, fmt.Errorf("%w: %d bytes after the delta", ErrInvalidSnapshot, len(data)-r.pos)
+	}
+	return d, nil
+}
+
+// Apply builds the snapshot that d turns base into, as
+// CSnapshotDelta::UnpackDelta does: the items of base that d does not delete
+// in their order, updated where d says so, followed by the items d adds. An
+// update whose size differs from the base item is an error. base is not
+// modified.
+func (base *Snapshot) Apply(d *Delta) (*Snapshot, error) {
+	deleted := make(map[int]bool, len(d.Deleted))
+	for _, key := range d.Deleted {
+		deleted[key] = true
+	}
+
+	to := &Snapshot{}
+	for _, item := range base.items {
+		if deleted[item.Key()] {
+			continue
+		}
+		item.Data = append([]int32(nil), item.Data...)
+		if err := to.Add(item); err != nil {
+			return nil, err
+		}
+	}
+
+	updated := make(map[int]bool, len(d.Updated))
+	for _, upd := range d.Updated {
+		key := upd.Key()
+		if updated[key] {
+			return nil, fmt.Errorf("%w: item type %d, ID %d updated twice", ErrInvalidSnapshot, upd.Type, upd.ID)
+		}
+		updated[key] = true
+
+		data := make([]int32, len(upd.Data))
+		if i, ok := base.index[key]; ok {
+			past := base.items[i].Data
+			if len(past) != len(data) {
+				return nil, fmt.Errorf("%w: update of item type %d, ID %d has %d fields, base item %d", ErrInvalidSnapshot, upd.Type, upd.ID, len(data), len(past))
+			}
+			for j := range data {
+				data[j] = past[j] + upd.Data[j]
+			}
+		} else {
+			copy(data, upd.Data)
+		}
+
+		if j, ok := to.index[key]; ok {
+			// a kept item of base, updated in place
+			to.items[j].Data = data
+			continue
+		}
+		if err := to.Add(Item{Type: upd.Type, ID: upd.ID, Data: data}); err != nil {
+			return nil, err
+		}
+	}
+	return to, nil
+}
+
+// UnpackDelta decodes the delta data and applies it to base, see ParseDelta
+// and Apply.
+func UnpackDelta(base *Snapshot, data []byte, sizes ItemSizes) (*Snapshot, error) {
+	d, err := ParseDelta(data, sizes)
+	if err != nil {
+		return nil, err
+	}
+	return base.Apply(d)
+}
+
+// deltaReader reads the CVariableInt packed ints of a delta, keeping the
+// first error.
+type deltaReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *deltaReader) int(what string) int32 {
+	if r.err != nil {
+		return 0
+	}
+	v, n, err := huffman.ReadVarInt(r.data[r.pos:])
+	if err != nil {
+		r.err = fmt.Errorf("%w: %s at offset %d: %w", ErrInvalidSnapshot, what, r.pos, err)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// CreateDelta computes the delta that turns base into to, as
+// CSnapshotDelta::CreateDelta does: the keys of the items of base missing
+// from to, then every item of to that is new or differs from base, in the
+// order of to. An item that changes size is an error, as no delta can express
+// it.
+func CreateDelta(base, to *Snapshot) (*Delta, error) {
+	d := &Delta{}
+	for _, item := range base.items {
+		if _, ok := to.index[item.Key()]; !ok {
+			d.Deleted = append(d.Deleted, item.Key())
+		}
+	}
+
+	for _, item := range to.items {
+		i, ok := base.index[item.Key()]
+		if !ok {
+			d.Updated = append(d.Updated, Item{Type: item.Type, ID: item.ID, Data: append([]int32(nil), item.Data...)})
+			continue
+		}
+		past := base.items[i].Data
+		if len(past) != len(item.Data) {
+			return nil, fmt.Errorf("%w: item type %d, ID %d changes from %d to %d fields", ErrInvalidSnapshot, item.Type, item.ID, len(past), len(item.Data))
+		}
+		var diff []int32
+		for j, v := range item.Data {
+			if v != past[j] && diff == nil {
+				diff = make([]int32, len(item.Data))
+			}
+			if diff != nil {
+				diff[j] = v - past[j]
+			}
+		}
+		if diff != nil {
+			d.Updated = append(d.Updated, Item{Type: item.Type, ID: item.ID, Data: diff})
+		}
+	}
+	return d, nil
+}
+
+// AppendDelta appends d to dst in the format ParseDelta reads, leaving out the
+// sizes of the item types in sizes. Like the reference server, it appends
+// nothing at all for a delta without any change; such a snapshot is sent as
+// NETMSG_SNAPEMPTY instead. An item whose size contradicts sizes is an error.
+func AppendDelta(dst []byte, d *Delta, sizes ItemSizes) ([]byte, error) {
+	if len(d.Deleted) == 0 && len(d.Updated) == 0 && d.NumTemp == 0 {
+		return dst, nil
+	}
+	for _, item := range d.Updated {
+		if size := sizes.of(item.Type); size != 0 && size != len(item.Data) {
+			return dst, fmt.Errorf("%w: item type %d, ID %d has %d fields, its type %d", ErrInvalidSnapshot, item.Type, item.ID, len(item.Data), size)
+		}
+	}
+
+	dst = huffman.AppendVarInt(dst, int32(len(d.Deleted)))
+	dst = huffman.AppendVarInt(dst, int32(len(d.Updated)))
+	dst = huffman.AppendVarInt(dst, int32(d.NumTemp))
+	for _, key := range d.Deleted {
+		dst = huffman.AppendVarInt(dst, int32(key))
+	}
+	for _, item := range d.Updated {
+		dst = huffman.AppendVarInt(dst, int32(item.Type))
+		dst = huffman.AppendVarInt(dst, int32(item.ID))
+		if sizes.of(item.Type) == 0 {
+			dst = huffman.AppendVarInt(dst, int32(len(item.Data)))
+		}
+		for _, v := range item.Data {
+			dst = huffman.AppendVarInt(dst, v)
+		}
+	}
+	return dst, nil
+}
+
+// PackDelta appends the delta from base to to, see CreateDelta and
+// AppendDelta. The result is the snapshot data a server compresses with
+// Huffman and splits into NETMSG_SNAP parts; if nothing changed, dst is
+// returned as it is.
+func PackDelta(dst []byte, base, to *Snapshot, sizes ItemSizes) ([]byte, error) {
+	d, err := CreateDelta(base, to)
+	if err != nil {
+		return dst, err
+	}
+	return AppendDelta(dst, d, sizes)
+}
@@ -0,0 +1,181 @@
+package snapshot
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/teeworlds-go/huffman/v2"
+	"github.com/teeworlds-go/huffman/v2/msg"
+	"github.com/teeworlds-go/huffman/v2/packet"
+)
+
+// realSnapPayload is the decompressed payload of a 0.7 packet carrying a
+// NETMSG_SNAPSINGLE, the "real snap single" capture of the root package tests.
+var realSnapPayload = []byte{
+	0x00, 0x36, 0x11, 0x9a, 0x01, 0x9b, 0x01, 0xa2, 0x9d, 0x04, 0x2d, 0x00, 0x03, 0x00, 0x06, 0x00,
+	0x00, 0x01, 0x00, 0x0a, 0x00, 0x84, 0x01, 0xb0, 0xe6, 0x01, 0x91, 0x26, 0x00, 0x80, 0x02, 0x00,
+	0x00, 0x00, 0x40, 0x00, 0x00, 0xb0, 0xe6, 0x01, 0x90, 0x26, 0x00, 0x00, 0x0a, 0x00, 0x0a, 0x01,
+	0x00, 0x00, 0x00, 0x0b, 0x00, 0x08, 0x00, 0x00,
+}
+
+// sizes07 are the 0.7 sizes of the items in realSnapPayload: GAMEDATA,
+// CHARACTER and PLAYERINFO.
+var sizes07 = ItemSizes{6: 3, 10: 22, 11: 3}
+
+// varInts packs vs with CVariableInt, the way deltas are sent.
+func varInts(vs ...int32) []byte {
+	var out []byte
+	for _, v := range vs {
+		out = huffman.AppendVarInt(out, v)
+	}
+	return out
+}
+
+func TestUnpackRealSnapSingle(t *testing.T) {
+	snap := realSnapSingle(t, sizes07)
+
+	var keys []int
+	for _, item := range snap.Items() {
+		keys = append(keys, item.Key())
+	}
+	if want := []int{Key(6, 0), Key(10, 0), Key(11, 0)}; !slices.Equal(keys, want) {
+		t.Fatalf("keys = %x, want %x", keys, want)
+	}
+	info, ok := snap.Find(11, 0)
+	if !ok || !slices.Equal(info.Data, []int32{8, 0, 0}) {
+		t.Fatalf("PLAYERINFO = %v, %v", info, ok)
+	}
+}
+
+// realSnapSingle decodes the snapshot of realSnapPayload with sizes and checks
+// it against the checksum the server sent.
+func realSnapSingle(t *testing.T, sizes ItemSizes) *Snapshot {
+	t.Helper()
+	data, crc := realSnapDelta(t)
+	snap, err := UnpackDelta(&Snapshot{}, data, sizes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Crc() != crc {
+		t.Fatalf("Crc = %d, server sent %d", snap.Crc(), crc)
+	}
+	return snap
+}
+
+// realSnapDelta returns the delta data and checksum of the NETMSG_SNAPSINGLE
+// in realSnapPayload, a full snapshot.
+func realSnapDelta(t *testing.T) ([]byte, int32) {
+	t.Helper()
+	var body []byte
+	for c, err := range packet.Chunks(packet.Version07, realSnapPayload) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = c.Body
+	}
+
+	u := msg.NewUnpacker(body)
+	h := u.UnpackHeader(packet.Version07)
+	gameTick := u.Int()
+	deltaTick := gameTick - u.Int()
+	crc := u.Int()
+	data := u.Raw(int(u.Int()))
+	if u.Err() != nil {
+		t.Fatal(u.Err())
+	}
+	if h != (msg.Header{ID: 8, System: true}) || deltaTick != -1 {
+		t.Fatalf("header %+v, delta tick %d: not a full NETMSG_SNAPSINGLE", h, deltaTick)
+	}
+
+	return data, crc
+}
+
+func TestApplyDelta(t *testing.T) {
+	base := &Snapshot{}
+	for _, item := range []Item{
+		{Type: 1, ID: 0, Data: []int32{10, 20}},
+		{Type: 1, ID: 1, Data: []int32{30, 40}},
+		{Type: 2, ID: 5, Data: []int32{7}},
+	} {
+		if err := base.Add(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data := varInts(
+		1, 2, 0, // one deleted, two updated
+		int32(Key(1, 1)),
+		1, 0, 5, -20, // diff to 1:0
+		3, 9, 2, 100, -1, // new 3:9 with sent size
+	)
+	snap, err := UnpackDelta(base, data, ItemSizes{1: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Item{
+		{Type: 1, ID: 0, Data: []int32{15, 0}},
+		{Type: 2, ID: 5, Data: []int32{7}},
+		{Type: 3, ID: 9, Data: []int32{100, -1}},
+	}
+	if !slices.EqualFunc(snap.Items(), want, func(a, b Item) bool {
+		return a.Type == b.Type && a.ID == b.ID && slices.Equal(a.Data, b.Data)
+	}) {
+		t.Fatalf("items = %v, want %v", snap.Items(), want)
+	}
+	if _, ok := snap.Find(1, 1); ok {
+		t.Fatalf("deleted item still found")
+	}
+	if item, _ := base.Find(1, 0); !slices.Equal(item.Data, []int32{10, 20}) {
+		t.Fatalf("base modified: %v", item.Data)
+	}
+}
+
+func TestParseDeltaInvalid(t *testing.T) {
+	table := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated header", varInts(0, 1)},
+		{"negative count", varInts(-1, 0, 0)},
+		{"count past the end", varInts(0, 100, 0)},
+		{"deleted key missing", varInts(2, 0, 0, 1)},
+		{"type out of range", varInts(0, 1, 0, 0x10000, 0, 0)},
+		{"negative ID", varInts(0, 1, 0, 3, -1, 0)},
+		{"negative size", varInts(0, 1, 0, 3, 0, -1)},
+		{"fields missing", varInts(0, 1, 0, 3, 0, 4, 1, 2)},
+		{"static fields missing", varInts(0, 1, 0, 1, 0, 1)},
+		{"trailing data", varInts(0, 0, 0, 0)},
+		{"truncated int", []byte{0x00, 0x00, 0x80}},
+	}
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseDelta(test.data, ItemSizes{1: 2}); !errors.Is(err, ErrInvalidSnapshot) {
+				t.Fatalf("err = %v, want ErrInvalidSnapshot", err)
+			}
+		})
+	}
+}
+
+func TestApplyDeltaInvalid(t *testing.T) {
+	base := &Snapshot{}
+	if err := base.Add(Item{Type: 3, ID: 0, Data: []int32{1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+	table := []struct {
+		name string
+		data []byte
+	}{
+		{"size differs from base", varInts(0, 1, 0, 3, 0, 1, 5)},
+		{"updated twice", varInts(0, 2, 0, 3, 1, 1, 5, 3, 1, 1, 6)},
+	}
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := UnpackDelta(base, test.data, nil); !errors.Is(err, ErrInvalidSnapshot) {
+				t.Fatalf("err = %v, want ErrInvalidSnapshot", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package snapshot
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/teeworlds-go/huffman/v2"
+	"github.com/teeworlds-go/huffman/v2/msg"
+)
+
+// The server packs a full snapshot exactly as captured.
+func TestPackDeltaRealSnap(t *testing.T) {
+	want, _ := realSnapDelta(t)
+	snap := realSnapSingle(t, sizes07)
+
+	got, err := PackDelta(nil, &Snapshot{}, snap, Vanilla07().ItemSizes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("PackDelta = %x\nwant        %x", got, want)
+	}
+}
+
+func TestPackDeltaUnchanged(t *testing.T) {
+	snap := realSnapSingle(t, sizes07)
+	got, err := PackDelta([]byte("keep"), snap, snap, sizes07)
+	if err != nil || string(got) != "keep" {
+		t.Fatalf("PackDelta = %q, %v, want nothing appended", got, err)
+	}
+}
+
+func TestPackDeltaInvalid(t *testing.T) {
+	var base, resized, wrongStatic Snapshot
+	for _, err := range []error{
+		base.Add(Item{Type: 11, ID: 0, Data: []int32{1, 2, 3}}),
+		resized.Add(Item{Type: 11, ID: 0, Data: []int32{1, 2}}),
+		wrongStatic.Add(Item{Type: 11, ID: 1, Data: []int32{1, 2}}),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := PackDelta(nil, &base, &resized, sizes07); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("resized item: err = %v, want ErrInvalidSnapshot", err)
+	}
+	if _, err := PackDelta(nil, &base, &wrongStatic, sizes07); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Errorf("item against static size: err = %v, want ErrInvalidSnapshot", err)
+	}
+}
+
+// randomSnapshot derives a snapshot from prev the way a game tick changes
+// one: some items vanish, some change, some appear. Types 1 to 3 have static
+// sizes, 0x7fff is an extended type declared in every snapshot.
+func randomSnapshot(rng *rand.Rand, prev *Snapshot) *Snapshot {
+	sizes := map[int]int{1: 4, 2: 1, 3: 22, 0x7fff: 3}
+	s := &Snapshot{}
+	if err := s.Add(uuidItem(0x7fff, msg.UUIDFromName("character@netobj.ddnet.tw"))); err != nil {
+		panic(err)
+	}
+	for _, item := range prev.Items() {
+		if item.Type == typeEx || rng.IntN(8) == 0 {
+			continue
+		}
+		data := slices.Clone(item.Data)
+		if rng.IntN(2) == 0 {
+			for i := range data {
+				if rng.IntN(3) == 0 {
+					data[i] += rng.Int32N(2000) - 1000
+				}
+			}
+		}
+		if err := s.Add(Item{Type: item.Type, ID: item.ID, Data: data}); err != nil {
+			panic(err)
+		}
+	}
+	for range rng.IntN(6) {
+		typ := []int{1, 2, 3, 0x7fff}[rng.IntN(4)]
+		data := make([]int32, sizes[typ])
+		for i := range data {
+			data[i] = int32(rng.Uint32())
+		}
+		// a taken key is simply skipped
+		_ = s.Add(Item{Type: typ, ID: rng.IntN(64), Data: data})
+	}
+	return s
+}
+
+func itemMap(s *Snapshot) map[int][]int32 {
+	m := make(map[int][]int32, s.Len())
+	for _, item := range s.Items() {
+		m[item.Key()] = item.Data
+	}
+	return m
+}
+
+// Deltas survive Huffman compression and decode to the snapshot they were
+// made from, tick after tick.
+func TestPackDeltaRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	huff := huffman.NewHuffman()
+	sizes := ItemSizes{1: 4, 2: 1, 3: 22}
+
+	client := &Snapshot{}
+	server := &Snapshot{}
+	for tick := range 200 {
+		next := randomSnapshot(rng, server)
+		data, err := PackDelta(nil, server, next, sizes)
+		if err != nil {
+			t.Fatalf("tick %d: %v", tick, err)
+		}
+		if len(data) == 0 {
+			// NETMSG_SNAPEMPTY: the client keeps its snapshot
+			server = next
+			continue
+		}
+
+		compressed, err := huff.Compress(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decompressed, err := huff.Decompress(compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := UnpackDelta(client, decompressed, sizes)
+		if err != nil {
+			t.Fatalf("tick %d: %v", tick, err)
+		}
+		if !maps.EqualFunc(itemMap(got), itemMap(next), slices.Equal) {
+			t.Fatalf("tick %d: decoded %v, want %v", tick, got.Items(), next.Items())
+		}
+		if got.Crc() != next.Crc() {
+			t.Fatalf("tick %d: Crc = %d, want %d", tick, got.Crc(), next.Crc())
+		}
+		client, server = got, next
+	}
+}
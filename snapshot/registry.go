@@ -0,0 +1,209 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/teeworlds-go/huffman/v2/msg"
+)
+
+const (
+	// typeEx is NETOBJTYPE_EX: an item of this type declares an extended
+	// type, its ID being the type number the snapshot uses and its data the
+	// UUID of the type.
+	typeEx = 0
+
+	// minExtendedType is OFFSET_UUID_TYPE, from where ddnet numbers the
+	// extended types of a snapshot.
+	minExtendedType = 0x4000
+)
+
+// ItemType describes the items of one type.
+type ItemType struct {
+	Name string
+	// Type is the number of a static type, the same in every snapshot.
+	Type int
+	// UUID identifies an extended type, whose number is declared by each
+	// snapshot using it. Zero for static types.
+	UUID msg.UUID
+	// Fields names the fields of the item in order.
+	Fields []string
+}
+
+// Extended reports whether t is an extended type, identified by UUID.
+func (t ItemType) Extended() bool {
+	return t.UUID != msg.UUID{}
+}
+
+// Registry maps items to their ItemType. The registries of Vanilla06,
+// Vanilla07 and DDNet know the types of their versions; mods add their own
+// with Register.
+type Registry struct {
+	byType map[int]*ItemType
+	byUUID map[msg.UUID]*ItemType
+}
+
+// NewRegistry creates a Registry knowing types. It panics if they conflict,
+// see Register.
+func NewRegistry(types ...ItemType) *Registry {
+	r := &Registry{
+		byType: make(map[int]*ItemType),
+		byUUID: make(map[msg.UUID]*ItemType),
+	}
+	for _, t := range types {
+		if err := r.Register(t); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Register adds t to r. A static type needs a number from 1 up to but
+// excluding the extended range, an extended one a UUID that is not taken yet.
+func (r *Registry) Register(t ItemType) error {
+	if t.Extended() {
+		if prev, ok := r.byUUID[t.UUID]; ok {
+			return fmt.Errorf("%w: item type %s has the UUID of %s", ErrInvalidSnapshot, t.Name, prev.Name)
+		}
+		t.Type = 0
+		r.byUUID[t.UUID] = &t
+		return nil
+	}
+	if t.Type <= typeEx || t.Type >= minExtendedType {
+		return fmt.Errorf("%w: item type %s has number %d, want 1 to %d", ErrInvalidSnapshot, t.Name, t.Type, minExtendedType-1)
+	}
+	if prev, ok := r.byType[t.Type]; ok {
+		return fmt.Errorf("%w: item type %s has the number of %s", ErrInvalidSnapshot, t.Name, prev.Name)
+	}
+	r.byType[t.Type] = &t
+	return nil
+}
+
+// ItemSizes returns the sizes of the static types of r, for ParseDelta.
+func (r *Registry) ItemSizes() ItemSizes {
+	var sizes ItemSizes
+	for typ, t := range r.byType {
+		if typ >= len(sizes) {
+			sizes = append(sizes, make(ItemSizes, typ+1-len(sizes))...)
+		}
+		sizes[typ] = len(t.Fields)
+	}
+	return sizes
+}
+
+// Lookup returns the type of item, which is in s, and whether r knows it.
+// Extended types are resolved through the declarations in s. The ItemType is
+// shared and must not be modified.
+func (r *Registry) Lookup(s *Snapshot, item Item) (*ItemType, bool) {
+	if item.Type < minExtendedType {
+		t, ok := r.byType[item.Type]
+		return t, ok
+	}
+	uuid, ok := s.ExtendedType(item.Type)
+	if !ok {
+		return nil, false
+	}
+	t, ok := r.byUUID[uuid]
+	return t, ok
+}
+
+// FieldMap returns the fields of item, which is in s, by name. Fields beyond
+// those its type names, as newer servers may send for extended types, are
+// named by their index, such as "#11".
+func (r *Registry) FieldMap(s *Snapshot, item Item) (map[string]int32, error) {
+	t, ok := r.Lookup(s, item)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown item type %d", ErrInvalidSnapshot, item.Type)
+	}
+	if len(item.Data) < len(t.Fields) {
+		return nil, fmt.Errorf("%w: item %s has %d fields, want %d", ErrInvalidSnapshot, t.Name, len(item.Data), len(t.Fields))
+	}
+	fields := make(map[string]int32, len(item.Data))
+	for i, v := range item.Data {
+		if i < len(t.Fields) {
+			fields[t.Fields[i]] = v
+		} else {
+			fields["#"+strconv.Itoa(i)] = v
+		}
+	}
+	return fields, nil
+}
+
+// ExtendedType returns the UUID a declaration in s gives the extended type
+// number typ, and whether there is one.
+func (s *Snapshot) ExtendedType(typ int) (msg.UUID, bool) {
+	var uuid msg.UUID
+	decl, ok := s.Find(typeEx, typ)
+	if !ok || len(decl.Data) != len(uuid)/4 {
+		return uuid, false
+	}
+	for i, v := range decl.Data {
+		binary.BigEndian.PutUint32(uuid[4*i:], uint32(v))
+	}
+	return uuid, true
+}
+
+// DecodeItem fills v, a pointer to a struct of int32 and int32 array fields,
+// with the data of item, field by field in order. Fields the item has beyond
+// the struct are ignored, so a struct for an extended type keeps working when
+// the type grows.
+func DecodeItem(item Item, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || !onlyInt32(rv.Type().Elem()) {
+		return fmt.Errorf("%w: cannot decode an item into %T", ErrInvalidSnapshot, v)
+	}
+	size := binary.Size(v)
+	if size > 4*len(item.Data) {
+		return fmt.Errorf("%w: item type %d has %d fields, %T wants %d", ErrInvalidSnapshot, item.Type, len(item.Data), v, size/4)
+	}
+	buf := make([]byte, 0, size)
+	for _, d := range item.Data[:size/4] {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(d))
+	}
+	if _, err := binary.Decode(buf, binary.LittleEndian, v); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+	}
+	return nil
+}
+
+// onlyInt32 reports whether t is made of int32 alone, in structs and arrays.
+func onlyInt32(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int32:
+		return true
+	case reflect.Array:
+		return onlyInt32(t.Elem())
+	case reflect.Struct:
+		for i := range t.NumField() {
+			if !onlyInt32(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// fields expands a list of field names, where "Name[4]" stands for the four
+// fields "Name[0]" to "Name[3]".
+func fields(names ...string) []string {
+	var out []string
+	for _, name := range names {
+		open := strings.IndexByte(name, '[')
+		if open < 0 {
+			out = append(out, name)
+			continue
+		}
+		n, err := strconv.Atoi(name[open+1 : len(name)-1])
+		if err != nil {
+			panic("snapshot: bad field " + name)
+		}
+		for i := range n {
+			out = append(out, name[:open]+"["+strconv.Itoa(i)+"]")
+		}
+	}
+	return out
+}
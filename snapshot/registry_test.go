@@ -0,0 +1,159 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"errors"
+	"maps"
+	"testing"
+
+	"github.com/teeworlds-go/huffman/v2/msg"
+)
+
+func TestRegistrySizes(t *testing.T) {
+	table := []struct {
+		name  string
+		sizes ItemSizes
+		want  map[int]int
+		total int
+	}{
+		{"0.6", Vanilla06().ItemSizes(), map[int]int{1: 10, 6: 8, 9: 22, 10: 5, 11: 17, 20: 3}, 21},
+		{"0.7", Vanilla07().ItemSizes(), map[int]int{6: 3, 10: 22, 11: 3, 13: 58, 15: 32, 22: 7}, 23},
+		{"ddnet", DDNet().ItemSizes(), map[int]int{9: 22, 11: 17}, 21},
+	}
+	for _, test := range table {
+		t.Run(test.name, func(t *testing.T) {
+			if len(test.sizes) != test.total {
+				t.Errorf("%d sizes, want %d", len(test.sizes), test.total)
+			}
+			for typ, size := range test.want {
+				if test.sizes[typ] != size {
+					t.Errorf("type %d: size %d, want %d", typ, test.sizes[typ], size)
+				}
+			}
+			if test.sizes[typeEx] != 0 {
+				t.Errorf("NETOBJTYPE_EX has a static size")
+			}
+		})
+	}
+}
+
+func TestRegistryRealSnap(t *testing.T) {
+	r := Vanilla07()
+	snap := realSnapSingle(t, r.ItemSizes())
+
+	info, _ := snap.Find(11, 0)
+	fields, err := r.FieldMap(snap, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int32{"PlayerFlags": 8, "Score": 0, "Latency": 0}; !maps.Equal(fields, want) {
+		t.Fatalf("PlayerInfo = %v, want %v", fields, want)
+	}
+
+	var char struct {
+		Core struct {
+			Tick, X, Y int32
+			_          [12]int32
+		}
+		Health, Armor int32
+	}
+	item, _ := snap.Find(10, 0)
+	if err := DecodeItem(item, &char); err != nil {
+		t.Fatal(err)
+	}
+	fields, _ = r.FieldMap(snap, item)
+	if char.Core.X != fields["X"] || char.Core.Y != fields["Y"] || char.Health != fields["Health"] || char.Armor != fields["Armor"] {
+		t.Fatalf("DecodeItem = %+v, FieldMap = %v", char, fields)
+	}
+}
+
+// uuidItem returns the NETOBJTYPE_EX item declaring typ as the extended type
+// uuid.
+func uuidItem(typ int, uuid msg.UUID) Item {
+	item := Item{Type: typeEx, ID: typ, Data: make([]int32, 4)}
+	for i := range item.Data {
+		item.Data[i] = int32(binary.BigEndian.Uint32(uuid[4*i:]))
+	}
+	return item
+}
+
+func TestRegistryExtended(t *testing.T) {
+	r := DDNet()
+	var s Snapshot
+	for _, item := range []Item{
+		uuidItem(0x7fff, msg.UUIDFromName("player@netobj.ddnet.tw")),
+		uuidItem(0x7ffe, msg.UUIDFromName("unknown@example.com")),
+		{Type: 0x7fff, ID: 3, Data: []int32{1, 2, 42}},
+		{Type: 0x7ffe, ID: 3, Data: []int32{1}},
+		{Type: 0x7ffd, ID: 3, Data: []int32{1}},
+	} {
+		if err := s.Add(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	player, _ := s.Find(0x7fff, 3)
+	typ, ok := r.Lookup(&s, player)
+	if !ok || typ.Name != "DDNetPlayer" || !typ.Extended() {
+		t.Fatalf("Lookup = %+v, %v", typ, ok)
+	}
+	fields, err := r.FieldMap(&s, player)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a field newer than the table keeps its index
+	if want := map[string]int32{"Flags": 1, "AuthLevel": 2, "#2": 42}; !maps.Equal(fields, want) {
+		t.Fatalf("DDNetPlayer = %v, want %v", fields, want)
+	}
+
+	for _, typ := range []int{0x7ffe, 0x7ffd} {
+		item, _ := s.Find(typ, 3)
+		if _, err := r.FieldMap(&s, item); !errors.Is(err, ErrInvalidSnapshot) {
+			t.Errorf("type %#x: err = %v, want ErrInvalidSnapshot", typ, err)
+		}
+	}
+	if _, ok := Vanilla06().Lookup(&s, player); ok {
+		t.Errorf("0.6 registry knows a ddnet type")
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	r := DDNet()
+
+	mod := ItemType{Name: "ModFlag", Type: 42, Fields: fields("X", "Y", "Owner")}
+	if err := r.Register(mod); err != nil {
+		t.Fatal(err)
+	}
+	modEx := ItemType{Name: "ModEx", UUID: msg.UUIDFromName("thing@mod.example"), Fields: fields("A")}
+	if err := r.Register(modEx); err != nil {
+		t.Fatal(err)
+	}
+	if r.ItemSizes()[42] != 3 {
+		t.Errorf("registered type has no static size")
+	}
+	if DDNet().ItemSizes().of(42) != 0 {
+		t.Errorf("registering changed another registry")
+	}
+
+	for _, bad := range []ItemType{
+		{Name: "Taken", Type: 9},
+		{Name: "Zero", Type: typeEx},
+		{Name: "Extended range", Type: minExtendedType},
+		{Name: "Taken UUID", UUID: msg.UUIDFromName("character@netobj.ddnet.tw")},
+	} {
+		if err := r.Register(bad); !errors.Is(err, ErrInvalidSnapshot) {
+			t.Errorf("Register(%s): err = %v, want ErrInvalidSnapshot", bad.Name, err)
+		}
+	}
+}
+
+func TestDecodeItemInvalid(t *testing.T) {
+	item := Item{Type: 1, Data: []int32{1, 2}}
+	var three [3]int32
+	var odd struct{ A, B int16 }
+	for _, v := range []any{&three, &odd, new(int), struct{ A int32 }{}} {
+		if err := DecodeItem(item, v); !errors.Is(err, ErrInvalidSnapshot) {
+			t.Errorf("DecodeItem(%T): err = %v, want ErrInvalidSnapshot", v, err)
+		}
+	}
+}
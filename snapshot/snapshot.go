@@ -0,0 +1,114 @@
+// Package snapshot holds teeworlds snapshots, the game state a server sends
+// every tick, and decodes the deltas they travel as. A delta lists the items
+// deleted from a base snapshot and the items updated or added, the latter as
+// the difference to the base item, all packed with CVariableInt. It follows
+// CSnapshot, CSnapshotBuilder and CSnapshotDelta of the reference
+// implementations, which share the format between 0.6 and 0.7.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+)
+
+const (
+	// MaxItems is the largest number of items a snapshot holds.
+	MaxItems = 1024
+	// MaxSize is the largest size in bytes of a snapshot, counting four
+	// bytes of key plus the data of every item.
+	MaxSize = 64 << 10
+
+	// maxTypeID bounds item types and IDs, which share a 32 bit key.
+	maxTypeID = 0xffff
+)
+
+// Item is one object of a snapshot, such as a character or a projectile.
+type Item struct {
+	Type int
+	ID   int
+	// Data holds the fields of the item, as many as its type has.
+	Data []int32
+}
+
+// Key returns the key of an item of the given type and ID, which is unique
+// within a snapshot and how deltas refer to deleted items.
+func Key(typ, id int) int {
+	return typ<<16 | id
+}
+
+// Key returns the key of i, see Key.
+func (i Item) Key() int {
+	return Key(i.Type, i.ID)
+}
+
+// Snapshot is an ordered set of items with distinct keys. The zero value is
+// an empty snapshot, which is the base of the first delta a client receives.
+type Snapshot struct {
+	items []Item
+	index map[int]int // key to position in items
+	size  int         // bytes, as MaxSize counts them
+}
+
+// Len returns the number of items in s.
+func (s *Snapshot) Len() int {
+	return len(s.items)
+}
+
+// Items returns the items of s in order. The slice and the item data are
+// owned by s and must not be modified.
+func (s *Snapshot) Items() []Item {
+	return s.items
+}
+
+// Find returns the item of the given type and ID and whether s has one.
+func (s *Snapshot) Find(typ, id int) (Item, bool) {
+	i, ok := s.index[Key(typ, id)]
+	if !ok {
+		return Item{}, false
+	}
+	return s.items[i], true
+}
+
+// Add appends item to s. It fails, leaving s unchanged, if s already has an
+// item with the same key or would exceed MaxItems or MaxSize. s takes
+// ownership of item.Data.
+func (s *Snapshot) Add(item Item) error {
+	if item.Type < 0 || item.Type > maxTypeID || item.ID < 0 || item.ID > maxTypeID {
+		return fmt.Errorf("%w: item type %d, ID %d out of range", ErrInvalidSnapshot, item.Type, item.ID)
+	}
+	key := item.Key()
+	if _, ok := s.index[key]; ok {
+		return fmt.Errorf("%w: duplicate item type %d, ID %d", ErrInvalidSnapshot, item.Type, item.ID)
+	}
+	if len(s.items) >= MaxItems {
+		return fmt.Errorf("%w: more than %d items", ErrInvalidSnapshot, MaxItems)
+	}
+	size := 4 + 4*len(item.Data)
+	if size > MaxSize-s.size {
+		return fmt.Errorf("%w: item type %d, ID %d exceeds the maximum size of %d bytes", ErrInvalidSnapshot, item.Type, item.ID, MaxSize)
+	}
+
+	if s.index == nil {
+		s.index = make(map[int]int)
+	}
+	s.index[key] = len(s.items)
+	s.items = append(s.items, item)
+	s.size += size
+	return nil
+}
+
+// Crc returns the checksum of s the way CSnapshot::Crc computes it, the sum
+// of all item data, which the server sends along with each snapshot.
+func (s *Snapshot) Crc() int32 {
+	var crc int32
+	for _, item := range s.items {
+		for _, v := range item.Data {
+			crc += v
+		}
+	}
+	return crc
+}
@@ -0,0 +1,58 @@
+package snapshot
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSnapshotAdd(t *testing.T) {
+	var s Snapshot
+	if err := s.Add(Item{Type: 4, ID: 2, Data: []int32{1, -3}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Item{Type: 4, ID: 3, Data: []int32{5}}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 2 || s.Crc() != 3 {
+		t.Fatalf("Len = %d, Crc = %d", s.Len(), s.Crc())
+	}
+	if item, ok := s.Find(4, 3); !ok || item.Data[0] != 5 {
+		t.Fatalf("Find = %v, %v", item, ok)
+	}
+	if _, ok := s.Find(3, 4); ok {
+		t.Fatalf("found an item that was never added")
+	}
+
+	for _, item := range []Item{
+		{Type: 4, ID: 2},
+		{Type: -1},
+		{Type: 1, ID: 0x10000},
+	} {
+		if err := s.Add(item); !errors.Is(err, ErrInvalidSnapshot) {
+			t.Errorf("Add(%v): err = %v, want ErrInvalidSnapshot", item, err)
+		}
+	}
+	if s.Len() != 2 {
+		t.Fatalf("failed Add changed the snapshot")
+	}
+}
+
+func TestSnapshotLimits(t *testing.T) {
+	var s Snapshot
+	for i := range MaxItems {
+		if err := s.Add(Item{Type: 1, ID: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Add(Item{Type: 2}); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Fatalf("item %d: err = %v", MaxItems+1, err)
+	}
+
+	s = Snapshot{}
+	if err := s.Add(Item{Type: 1, Data: make([]int32, MaxSize/4-1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(Item{Type: 2}); !errors.Is(err, ErrInvalidSnapshot) {
+		t.Fatalf("past MaxSize: err = %v", err)
+	}
+}
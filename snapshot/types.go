@@ -0,0 +1,121 @@
+package snapshot
+
+import "github.com/teeworlds-go/huffman/v2/msg"
+
+// The item types below follow datasrc/network.py of the respective versions.
+// Field names drop the m_ prefix and any type prefix of the original.
+
+var characterCore = fields(
+	"Tick", "X", "Y", "VelX", "VelY", "Angle", "Direction", "Jumped",
+	"HookedPlayer", "HookState", "HookTick", "HookX", "HookY", "HookDx", "HookDy",
+)
+
+var playerInput = fields(
+	"Direction", "TargetX", "TargetY", "Jump", "Fire", "Hook", "PlayerFlags",
+	"WantedWeapon", "NextWeapon", "PrevWeapon",
+)
+
+var types06 = []ItemType{
+	{Name: "PlayerInput", Type: 1, Fields: playerInput},
+	{Name: "Projectile", Type: 2, Fields: fields("X", "Y", "VelX", "VelY", "Type", "StartTick")},
+	{Name: "Laser", Type: 3, Fields: fields("X", "Y", "FromX", "FromY", "StartTick")},
+	{Name: "Pickup", Type: 4, Fields: fields("X", "Y", "Type", "Subtype")},
+	{Name: "Flag", Type: 5, Fields: fields("X", "Y", "Team")},
+	{Name: "GameInfo", Type: 6, Fields: fields("GameFlags", "GameStateFlags", "RoundStartTick", "WarmupTimer", "ScoreLimit", "TimeLimit", "RoundNum", "RoundCurrent")},
+	{Name: "GameData", Type: 7, Fields: fields("TeamscoreRed", "TeamscoreBlue", "FlagCarrierRed", "FlagCarrierBlue")},
+	{Name: "CharacterCore", Type: 8, Fields: characterCore},
+	{Name: "Character", Type: 9, Fields: withCore("PlayerFlags", "Health", "Armor", "AmmoCount", "Weapon", "Emote", "AttackTick")},
+	{Name: "PlayerInfo", Type: 10, Fields: fields("Local", "ClientID", "Team", "Score", "Latency")},
+	{Name: "ClientInfo", Type: 11, Fields: fields("Name[4]", "Clan[3]", "Country", "Skin[6]", "UseCustomColor", "ColorBody", "ColorFeet")},
+	{Name: "SpectatorInfo", Type: 12, Fields: fields("SpectatorID", "X", "Y")},
+	{Name: "Common", Type: 13, Fields: fields("X", "Y")},
+	{Name: "Explosion", Type: 14, Fields: fields("X", "Y")},
+	{Name: "Spawn", Type: 15, Fields: fields("X", "Y")},
+	{Name: "HammerHit", Type: 16, Fields: fields("X", "Y")},
+	{Name: "Death", Type: 17, Fields: fields("X", "Y", "ClientID")},
+	{Name: "SoundGlobal", Type: 18, Fields: fields("X", "Y", "SoundID")},
+	{Name: "SoundWorld", Type: 19, Fields: fields("X", "Y", "SoundID")},
+	{Name: "DamageInd", Type: 20, Fields: fields("X", "Y", "Angle")},
+}
+
+var types07 = []ItemType{
+	{Name: "PlayerInput", Type: 1, Fields: playerInput},
+	{Name: "Projectile", Type: 2, Fields: fields("X", "Y", "VelX", "VelY", "Type", "StartTick")},
+	{Name: "Laser", Type: 3, Fields: fields("X", "Y", "FromX", "FromY", "StartTick")},
+	{Name: "Pickup", Type: 4, Fields: fields("X", "Y", "Type")},
+	{Name: "Flag", Type: 5, Fields: fields("X", "Y", "Team")},
+	{Name: "GameData", Type: 6, Fields: fields("GameStartTick", "GameStateFlags", "GameStateEndTick")},
+	{Name: "GameDataTeam", Type: 7, Fields: fields("TeamscoreRed", "TeamscoreBlue")},
+	{Name: "GameDataFlag", Type: 8, Fields: fields("FlagCarrierRed", "FlagCarrierBlue", "FlagDropTickRed", "FlagDropTickBlue")},
+	{Name: "CharacterCore", Type: 9, Fields: characterCore},
+	{Name: "Character", Type: 10, Fields: withCore("Health", "Armor", "AmmoCount", "Weapon", "Emote", "AttackTick", "TriggeredEvents")},
+	{Name: "PlayerInfo", Type: 11, Fields: fields("PlayerFlags", "Score", "Latency")},
+	{Name: "SpectatorInfo", Type: 12, Fields: fields("SpecMode", "SpectatorID", "X", "Y")},
+	{Name: "De_ClientInfo", Type: 13, Fields: fields("Local", "Team", "Name[4]", "Clan[3]", "Country", "SkinPartNames[36]", "UseCustomColors[6]", "SkinPartColors[6]")},
+	{Name: "De_GameInfo", Type: 14, Fields: fields("GameFlags", "ScoreLimit", "TimeLimit", "MatchNum", "MatchCurrent")},
+	{Name: "De_TuneParams", Type: 15, Fields: fields("TuneParams[32]")},
+	{Name: "Common", Type: 16, Fields: fields("X", "Y")},
+	{Name: "Explosion", Type: 17, Fields: fields("X", "Y")},
+	{Name: "Spawn", Type: 18, Fields: fields("X", "Y")},
+	{Name: "HammerHit", Type: 19, Fields: fields("X", "Y")},
+	{Name: "Death", Type: 20, Fields: fields("X", "Y", "ClientID")},
+	{Name: "SoundWorld", Type: 21, Fields: fields("X", "Y", "SoundID")},
+	{Name: "Damage", Type: 22, Fields: fields("X", "Y", "ClientID", "Angle", "HealthAmount", "ArmorAmount", "Self")},
+}
+
+// typesDDNet are the extended types ddnet adds to those of 0.6.
+var typesDDNet = []ItemType{
+	extended("MyOwnObject", "my-own-object@heinrich5991.de", "Test"),
+	extended("DDNetCharacter", "character@netobj.ddnet.tw",
+		"Flags", "FreezeEnd", "Jumps", "TeleCheckpoint", "StrongWeakID",
+		"JumpedTotal", "NinjaActivationTick", "FreezeStart", "TargetX", "TargetY",
+		"TuneZoneOverride"),
+	extended("DDNetPlayer", "player@netobj.ddnet.tw", "Flags", "AuthLevel"),
+	extended("GameInfoEx", "gameinfo@netobj.ddnet.tw", "Flags", "Version", "Flags2"),
+	extended("DDRaceProjectile", "projectile@netobj.ddnet.tw", "X", "Y", "Angle", "Data", "Type", "StartTick"),
+	extended("DDNetLaser", "laser@netobj.ddnet.tw",
+		"ToX", "ToY", "FromX", "FromY", "StartTick", "Owner", "Type", "SwitchNumber", "Subtype", "Flags"),
+	extended("DDNetProjectile", "ddnet-projectile@netobj.ddnet.tw",
+		"X", "Y", "VelX", "VelY", "Type", "StartTick", "Owner", "SwitchNumber", "TuneZone", "Flags"),
+	extended("DDNetPickup", "pickup@netobj.ddnet.tw", "X", "Y", "Type", "Subtype", "SwitchNumber", "Flags"),
+	extended("DDNetSpectatorInfo", "spectator-info@netobj.ddnet.org",
+		"HasCameraInfo", "Zoom", "Deadzone", "FollowFactor", "SpectatorCount"),
+	extended("SwitchState", "switch-state@netobj.ddnet.tw",
+		"HighestSwitchNumber", "Status[8]", "SwitchNumbers[4]", "EndTicks[4]"),
+	extended("Birthday", "birthday@netevent.ddnet.tw", "X", "Y"),
+	extended("Finish", "finish@netevent.ddnet.tw", "X", "Y"),
+	extended("MapSoundWorld", "map-sound-world@netevent.ddnet.org", "X", "Y", "SoundID"),
+}
+
+// withCore returns the fields of a character: those of its core, then names.
+func withCore(names ...string) []string {
+	return append(append([]string(nil), characterCore...), fields(names...)...)
+}
+
+func extended(name, uuidName string, names ...string) ItemType {
+	return ItemType{Name: name, UUID: msg.UUIDFromName(uuidName), Fields: fields(names...)}
+}
+
+// Vanilla06 returns a new Registry of the teeworlds 0.6 item types.
+func Vanilla06() *Registry {
+	return NewRegistry(types06...)
+}
+
+// Vanilla07 returns a new Registry of the teeworlds 0.7 item types, including
+// the De_ types only demos carry.
+func Vanilla07() *Registry {
+	return NewRegistry(types07...)
+}
+
+// DDNet returns a new Registry of the ddnet item types: those of 0.6 and the
+// extended types of ddnet. Extended items have their size sent in every
+// delta and grow over time, so items may have more fields than named here.
+func DDNet() *Registry {
+	r := NewRegistry(types06...)
+	for _, t := range typesDDNet {
+		if err := r.Register(t); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
@@ -0,0 +1,175 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// StreamWriter compresses everything written to it into a single stream. The
+// bit accumulator carries over from one Write to the next, and the EOF symbol
+// is only written by Close, so it can sit at the end of io.Copy and compress
+// a payload of any size without holding it in memory. Writer instead makes a
+// complete stream of every Write, which is what a packet or message wants.
+//
+// Output is buffered; nothing is guaranteed to have reached the underlying
+// writer before Flush or Close.
+type StreamWriter struct {
+	d      *Dictionary
+	w      io.Writer
+	buf    []byte
+	legacy bool
+	limit  int64
+
+	acc      uint64 // pending bits, LSB first, always fewer than 32
+	bitCount uint
+	bits     uint64 // bits encoded so far, for the output limit
+	closed   bool
+	err      error // sticky write error of w
+}
+
+// NewStreamWriter creates a new StreamWriter configured by opts, that uses
+// the default Teeworlds dictionary unless WithDictionary is given. An output
+// limit applies to the whole stream, EOF symbol included.
+func NewStreamWriter(w io.Writer, opts ...Option) *StreamWriter {
+	o := newOptions(opts)
+	return &StreamWriter{
+		d:      o.dict,
+		w:      w,
+		buf:    make([]byte, 0, o.bufSize),
+		legacy: o.legacyPadding,
+		limit:  o.outputLimit,
+	}
+}
+
+// Reset discards the state of w and makes it write a new stream to rw.
+func (w *StreamWriter) Reset(rw io.Writer) {
+	w.w = rw
+	w.buf = w.buf[:0]
+	w.acc, w.bitCount, w.bits = 0, 0, 0
+	w.closed = false
+	w.err = nil
+}
+
+// ResetDict is Reset that also replaces the dictionary. It checks d first and
+// leaves the StreamWriter unchanged if d cannot be used.
+func (w *StreamWriter) ResetDict(d *Dictionary, rw io.Writer) error {
+	if err := d.usable(ErrHuffmanCompress); err != nil {
+		return err
+	}
+	w.d = d
+	w.Reset(rw)
+	return nil
+}
+
+// Write compresses data into the stream and returns len(data) on success.
+// A write error of the underlying writer is sticky: it ends the stream and is
+// returned by every later call.
+func (w *StreamWriter) Write(data []byte) (int, error) {
+	if err := w.check(); err != nil {
+		return 0, err
+	}
+	d := w.d
+
+	// Judge the limit before encoding, so a rejected Write leaves the
+	// stream as it was. The EOF symbol has to fit as well, or Close fails.
+	if w.limit > 0 {
+		bits := w.bits + d.symbolBits(data)
+		if n := streamBytes(bits+uint64(d.encLen[EofSymbol]), w.legacy); n > uint64(w.limit) {
+			return 0, fmt.Errorf("%w: %w: stream needs %d bytes, limit is %d", ErrHuffmanCompress, ErrOutputLimit, n, w.limit)
+		}
+	}
+
+	var (
+		encBits  = &d.encBits
+		encLen   = &d.encLen
+		acc      = w.acc
+		bitCount = w.bitCount
+		buf      = w.buf
+	)
+	for _, symbol := range data {
+		acc |= uint64(encBits[symbol]) << bitCount
+		bitCount += uint(encLen[symbol])
+		w.bits += uint64(encLen[symbol])
+
+		if bitCount >= 32 {
+			if len(buf)+4 > cap(buf) {
+				if w.err = writeBuffer(w.w, buf); w.err != nil {
+					return 0, w.err
+				}
+				buf = buf[:0]
+			}
+			buf = binary.LittleEndian.AppendUint32(buf, uint32(acc))
+			acc >>= 32
+			bitCount -= 32
+		}
+	}
+	w.acc, w.bitCount, w.buf = acc, bitCount, buf
+	return len(data), nil
+}
+
+// Flush writes every complete byte of the stream to the underlying writer,
+// without ending it. Up to 7 bits remain pending: the stream cannot be padded
+// to a byte boundary without changing what it decodes to, as any bits put
+// into it are read as symbols. Flush makes the output so far available to a
+// reader, but it cannot end a message; only Close does.
+func (w *StreamWriter) Flush() error {
+	if err := w.check(); err != nil {
+		return err
+	}
+	w.drain()
+	return w.flush()
+}
+
+// Close writes the EOF symbol and the final partial byte and flushes the
+// stream. It does not close the underlying writer. Calling Close again is a
+// no-op; Write after Close is an error.
+func (w *StreamWriter) Close() error {
+	if w != nil && w.closed && w.err == nil {
+		return nil
+	}
+	if err := w.check(); err != nil {
+		return err
+	}
+	w.acc |= uint64(w.d.encBits[EofSymbol]) << w.bitCount
+	w.bitCount += uint(w.d.encLen[EofSymbol])
+	w.drain()
+	// trailing partial byte, only when bits actually remain (see Compress)
+	if w.bitCount != 0 || w.legacy {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.bitCount = 0, 0
+	}
+	w.closed = true
+	return w.flush()
+}
+
+// check returns the error that keeps w from writing, if any.
+func (w *StreamWriter) check() error {
+	switch {
+	case w == nil:
+		return fmt.Errorf("%w: writer is nil", ErrHuffmanCompress)
+	case w.err != nil:
+		return w.err
+	case w.closed:
+		return fmt.Errorf("%w: write after Close", ErrHuffmanCompress)
+	}
+	return w.d.usable(ErrHuffmanCompress)
+}
+
+// drain moves the complete bytes of the accumulator into buf.
+func (w *StreamWriter) drain() {
+	for w.bitCount >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.bitCount -= 8
+	}
+}
+
+func (w *StreamWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	w.err = writeBuffer(w.w, w.buf)
+	w.buf = w.buf[:0]
+	return w.err
+}
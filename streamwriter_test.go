@@ -0,0 +1,172 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestStreamWriterMatchesCompress(t *testing.T) {
+	for _, dc := range testDictionaries() {
+		for _, e := range regressionCorpus() {
+			want, err := NewHuffmanDict(dc.dict).Compress(e.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, chunk := range []int{1, 3, 64, 4096} {
+				var buf bytes.Buffer
+				w := NewStreamWriter(&buf, WithDictionary(dc.dict), WithBufferSize(16))
+				if chunk == 1 {
+					// io.Copy with one byte per Write
+					if _, err := io.Copy(w, iotest.OneByteReader(bytes.NewReader(e.data))); err != nil {
+						t.Fatal(err)
+					}
+				}
+				for p := e.data; chunk > 1 && len(p) > 0; p = p[min(chunk, len(p)):] {
+					if _, err := w.Write(p[:min(chunk, len(p))]); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(buf.Bytes(), want) {
+					t.Fatalf("%s/%s, chunks of %d: StreamWriter output differs from Compress", dc.name, e.name, chunk)
+				}
+			}
+		}
+	}
+}
+
+func TestStreamWriterFlush(t *testing.T) {
+	payload := snapshotLike(33, 3000)
+	want, err := Compress(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	w := NewStreamWriter(&buf)
+	for i, p := range [][]byte{payload[:1], payload[1:1000], payload[1000:]} {
+		if _, err := w.Write(p); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(want, buf.Bytes()) {
+			t.Fatalf("flush %d: output is not a prefix of the stream", i)
+		}
+		// all but the pending partial byte
+		if bits := int(w.bits); buf.Len() != bits/8 {
+			t.Fatalf("flush %d: %d bytes written, want the %d complete ones", i, buf.Len(), bits/8)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatal("flushed stream differs from Compress")
+	}
+}
+
+func TestStreamWriterFlushDecodes(t *testing.T) {
+	payload := snapshotLike(34, 3000)
+	for _, parts := range [][][]byte{
+		{[]byte("hello"), []byte(" world")},
+		{payload[:1], payload[1:7], payload[7:1000], payload[1000:]},
+	} {
+		var buf bytes.Buffer
+		w := NewStreamWriter(&buf)
+		for _, p := range parts {
+			if _, err := w.Write(p); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		want := bytes.Join(parts, nil)
+		got, err := Decompress(buf.Bytes())
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("Decompress after Write/Flush/Write/Close = %q, %v, want %d bytes", got[:min(len(got), 16)], err, len(want))
+		}
+		got, err = io.ReadAll(NewReader(bytes.NewReader(buf.Bytes())))
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("Reader after Write/Flush/Write/Close = %q, %v, want %d bytes", got[:min(len(got), 16)], err, len(want))
+		}
+	}
+}
+
+func TestStreamWriterClose(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewStreamWriter(&buf)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	if want, _ := Compress(nil); !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("empty stream = %x, want %x", buf.Bytes(), want)
+	}
+	if _, err := w.Write([]byte("x")); !errors.Is(err, ErrHuffmanCompress) {
+		t.Fatalf("Write after Close error = %v, want ErrHuffmanCompress", err)
+	}
+	if err := w.Flush(); !errors.Is(err, ErrHuffmanCompress) {
+		t.Fatalf("Flush after Close error = %v, want ErrHuffmanCompress", err)
+	}
+
+	// byte-aligned EOF symbol, see TestDDNetCompat
+	in := make([]byte, 64)
+	in[0] = 0x15
+	want, err := NewHuffman(WithLegacyPadding(true)).Compress(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	w = NewStreamWriter(&buf, WithLegacyPadding(true))
+	if _, err := w.Write(in); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil || !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("legacy padding = %x, %v, want %x", buf.Bytes(), err, want)
+	}
+}
+
+func TestStreamWriterErrors(t *testing.T) {
+	w := NewStreamWriter(shortWriter{}, WithBufferSize(16))
+	payload := bytes.Repeat([]byte{0xff}, 4096)
+	if _, err := w.Write(payload); !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("Write error = %v, want io.ErrShortWrite", err)
+	}
+	if err := w.Close(); !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("Close after a failed write = %v, want the sticky io.ErrShortWrite", err)
+	}
+
+	compressed, err := Compress(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w = NewStreamWriter(&buf, WithOutputLimit(int64(len(compressed))))
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("Write at the limit: %v", err)
+	}
+	if n, err := w.Write([]byte{0xff}); n != 0 || !errors.Is(err, ErrOutputLimit) {
+		t.Fatalf("Write over the limit = (%d, %v), want (0, ErrOutputLimit)", n, err)
+	}
+	if err := w.Close(); err != nil || !bytes.Equal(buf.Bytes(), compressed) {
+		t.Fatalf("Close after a rejected Write = %v, output differs: %t", err, !bytes.Equal(buf.Bytes(), compressed))
+	}
+
+	if _, err := NewStreamWriter(&buf, WithDictionary(nil)).Write(nil); !errors.Is(err, ErrHuffmanCompress) {
+		t.Fatalf("nil dictionary error = %v, want ErrHuffmanCompress", err)
+	}
+}
@@ -0,0 +1,91 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"iter"
+)
+
+// Symbols decodes data lazily, yielding one decompressed byte at a time until
+// the EOF symbol. A parser can consume the payload straight off the stream
+// without decompressing it into a buffer first, and stopping the range early
+// stops decoding.
+//
+// Errors are those of DecompressTo, yielded once as the last pair with a zero
+// byte. Unlike DecompressTo, the bytes yielded before an error are not taken
+// back: a stream that exceeds OutputLimit yields the allowed bytes first, and
+// a Strict trailer error comes after the whole payload.
+func (huff *Huffman) Symbols(data []byte) iter.Seq2[byte, error] {
+	return func(yield func(byte, error) bool) {
+		d, err := huff.dictionary(ErrHuffmanDecompress)
+		if err != nil {
+			yield(0, err)
+			return
+		}
+		if len(data) == 0 {
+			return
+		}
+
+		var (
+			lut      = &d.decLut
+			acc      uint64 // bit accumulator, LSB first
+			bitCount uint   // number of valid bits in acc
+			srcIndex int
+			n        int64 // bytes yielded
+			maxLen   = max(uint(d.maxCodeLen), lookupTableBits)
+		)
+		for {
+			// Refill only when a code might not fit, the same way the
+			// bulk loop of decompressTo does.
+			if bitCount < maxLen {
+				if len(data)-srcIndex >= 8 {
+					acc |= binary.LittleEndian.Uint64(data[srcIndex:]) << bitCount
+					srcIndex += int(63-bitCount) >> 3
+					bitCount |= 56
+				} else {
+					for bitCount < 56 && srcIndex < len(data) {
+						acc |= uint64(data[srcIndex]) << bitCount
+						srcIndex++
+						bitCount += 8
+					}
+				}
+			}
+
+			var (
+				sym     int
+				codeLen uint
+			)
+			entry := lut[acc&lookupTableMask]
+			if codeLen = uint(entry & lutLenMask); codeLen != 0 && codeLen <= bitCount {
+				sym = int(byte(entry >> lutSymShift))
+				if entry&lutEOFBit != 0 {
+					sym = EofSymbol
+				}
+			} else {
+				var err error
+				if sym, codeLen, err = d.decodeSymbol(acc, bitCount); err != nil {
+					yield(0, err)
+					return
+				}
+			}
+			acc >>= codeLen
+			bitCount -= codeLen
+
+			if sym == EofSymbol {
+				if huff.Strict {
+					if err := trailerOf(data, srcIndex*8-int(bitCount)).check(); err != nil {
+						yield(0, err)
+					}
+				}
+				return
+			}
+			if huff.OutputLimit > 0 && n == huff.OutputLimit {
+				yield(0, huff.checkDecoded(int(n)+1))
+				return
+			}
+			n++
+			if !yield(byte(sym), nil) {
+				return
+			}
+		}
+	}
+}
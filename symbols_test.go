@@ -0,0 +1,98 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// collectSymbols ranges over huff.Symbols(data) like a caller would.
+func collectSymbols(huff *Huffman, data []byte) ([]byte, error) {
+	var out []byte
+	for b, err := range huff.Symbols(data) {
+		if err != nil {
+			return out, err
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+func TestSymbolsMatchesDecompressTo(t *testing.T) {
+	for _, dc := range testDictionaries() {
+		huff := NewHuffmanDict(dc.dict)
+		for _, e := range regressionCorpus() {
+			compressed, err := huff.Compress(e.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := collectSymbols(huff, compressed)
+			if err != nil || !bytes.Equal(got, e.data) {
+				t.Fatalf("%s/%s: Symbols = %d bytes, %v, want the payload", dc.name, e.name, len(got), err)
+			}
+		}
+
+		for _, e := range malformedInputs() {
+			want, wantErr := huff.DecompressTo(nil, e.data)
+			got, err := collectSymbols(huff, e.data)
+			if (err == nil) != (wantErr == nil) || err != nil && err.Error() != wantErr.Error() {
+				t.Fatalf("%s/%s: Symbols error = %v, DecompressTo error = %v", dc.name, e.name, err, wantErr)
+			}
+			if err == nil && !bytes.Equal(got, want) {
+				t.Fatalf("%s/%s: Symbols = %x, DecompressTo = %x", dc.name, e.name, got, want)
+			}
+		}
+	}
+}
+
+func TestSymbolsErrors(t *testing.T) {
+	if _, err := collectSymbols(NewHuffmanDict(nil), []byte{1}); !errors.Is(err, ErrHuffmanDecompress) {
+		t.Fatalf("nil dictionary error = %v, want ErrHuffmanDecompress", err)
+	}
+
+	_, cases := trailerCases(t)
+	for _, c := range cases {
+		huff := NewHuffman(WithStrict(true))
+		want, _ := NewHuffman().Decompress(c.data)
+		got, err := collectSymbols(huff, c.data)
+		if c.strict && err != nil || !c.strict && !errors.Is(err, ErrTrailingData) {
+			t.Fatalf("%s: strict Symbols error = %v", c.name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s: strict Symbols yielded %x before the trailer, want %x", c.name, got, want)
+		}
+	}
+
+	payload := snapshotLike(32, 100)
+	compressed, err := Compress(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := collectSymbols(NewHuffman(WithOutputLimit(100)), compressed); err != nil || !bytes.Equal(got, payload) {
+		t.Fatalf("Symbols at the limit = %d bytes, %v", len(got), err)
+	}
+	got, err := collectSymbols(NewHuffman(WithOutputLimit(99)), compressed)
+	if !errors.Is(err, ErrOutputLimit) || !bytes.Equal(got, payload[:99]) {
+		t.Fatalf("Symbols over the limit = %d bytes, %v, want 99 bytes and ErrOutputLimit", len(got), err)
+	}
+}
+
+func TestSymbolsBreak(t *testing.T) {
+	compressed, err := Compress([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	for b, err := range NewHuffman().Symbols(compressed) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, b)
+		if b == ' ' {
+			break
+		}
+	}
+	if string(got) != "hello " {
+		t.Fatalf("Symbols with break = %q, want %q", got, "hello ")
+	}
+}
@@ -0,0 +1,69 @@
+package huffman
+
+import "fmt"
+
+var (
+	// ErrTrailingData is returned in strict mode when the padding bits after
+	// the EOF symbol are not zero, or when further data follows the stream.
+	ErrTrailingData = fmt.Errorf("%w: data after EOF symbol", ErrHuffmanDecompress)
+)
+
+// Trailer describes what followed the EOF symbol of a decoded stream.
+//
+// Every encoder pads the final byte with zero bits and stops there, except
+// teeworlds 0.7 (and ddnet before 4354f8c6), which writes one extra zero byte
+// when the EOF symbol ends exactly on a byte boundary. Anything else was put
+// there by something other than a reference encoder.
+type Trailer struct {
+	// Consumed is the number of input bytes the stream occupied, up to and
+	// including the byte that holds the last bit of the EOF symbol.
+	Consumed int64
+	// PaddingBits is the number of unused bits in that last byte.
+	PaddingBits int
+	// PaddingZero reports whether all PaddingBits were zero.
+	PaddingZero bool
+	// Extra is the number of input bytes seen after Consumed. Decoders that
+	// read from a stream can only report the bytes they actually read.
+	Extra int64
+	// ExtraZero reports whether all Extra bytes were zero.
+	ExtraZero bool
+}
+
+// legacyZeroByte reports whether the only data after the stream is the zero
+// byte teeworlds 0.7 appends after a byte-aligned EOF symbol.
+func (t Trailer) legacyZeroByte() bool {
+	return t.PaddingBits == 0 && t.Extra == 1 && t.ExtraZero
+}
+
+// check is the strict mode verdict on t.
+func (t Trailer) check() error {
+	if !t.PaddingZero {
+		return fmt.Errorf("%w: %d padding bits are not zero", ErrTrailingData, t.PaddingBits)
+	}
+	if t.Extra != 0 && !t.legacyZeroByte() {
+		return fmt.Errorf("%w: %d bytes follow the stream", ErrTrailingData, t.Extra)
+	}
+	return nil
+}
+
+// trailerOf inspects data after the first consumedBits bits.
+func trailerOf(data []byte, consumedBits int) Trailer {
+	consumed := (consumedBits + 7) / 8
+	t := Trailer{
+		Consumed:    int64(consumed),
+		PaddingBits: consumed*8 - consumedBits,
+		PaddingZero: true,
+		Extra:       int64(len(data) - consumed),
+		ExtraZero:   true,
+	}
+	if t.PaddingBits != 0 {
+		t.PaddingZero = data[consumed-1]>>(8-t.PaddingBits) == 0
+	}
+	for _, b := range data[consumed:] {
+		if b != 0 {
+			t.ExtraZero = false
+			break
+		}
+	}
+	return t
+}
@@ -0,0 +1,137 @@
+package huffman
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// trailerCases builds streams with every kind of trailer from one payload
+// whose EOF symbol does not end on a byte boundary.
+func trailerCases(t *testing.T) (valid []byte, cases []trailerCase) {
+	t.Helper()
+	valid, err := Compress([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, tr, err := NewHuffman().DecompressTrailer(nil, valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.PaddingBits == 0 {
+		t.Fatal("test payload needs padding bits")
+	}
+
+	dirtyPadding := append([]byte(nil), valid...)
+	dirtyPadding[len(dirtyPadding)-1] |= 0x80
+
+	// ddnet TEST(Huffman, CompressionNoTrailingNull): byte-aligned EOF
+	aligned := []byte{0xBE, 0xFD, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x15, 0x37}
+
+	return valid, []trailerCase{
+		{"clean", valid, Trailer{Consumed: int64(len(valid)), PaddingBits: tr.PaddingBits, PaddingZero: true, ExtraZero: true}, true},
+		{"dirty padding", dirtyPadding, Trailer{Consumed: int64(len(valid)), PaddingBits: tr.PaddingBits, ExtraZero: true}, false},
+		{"zero byte after padding", append(append([]byte(nil), valid...), 0), Trailer{Consumed: int64(len(valid)), PaddingBits: tr.PaddingBits, PaddingZero: true, Extra: 1, ExtraZero: true}, false},
+		{"smuggled bytes", append(append([]byte(nil), valid...), 'h', 'i'), Trailer{Consumed: int64(len(valid)), PaddingBits: tr.PaddingBits, PaddingZero: true, Extra: 2}, false},
+		{"aligned", aligned, Trailer{Consumed: int64(len(aligned)), PaddingZero: true, ExtraZero: true}, true},
+		{"aligned legacy zero byte", append(append([]byte(nil), aligned...), 0), Trailer{Consumed: int64(len(aligned)), PaddingZero: true, Extra: 1, ExtraZero: true}, true},
+		{"aligned two zero bytes", append(append([]byte(nil), aligned...), 0, 0), Trailer{Consumed: int64(len(aligned)), PaddingZero: true, Extra: 2, ExtraZero: true}, false},
+	}
+}
+
+type trailerCase struct {
+	name   string
+	data   []byte
+	want   Trailer
+	strict bool // accepted in strict mode
+}
+
+func TestDecompressTrailer(t *testing.T) {
+	_, cases := trailerCases(t)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			huff := NewHuffman()
+			want, err := huff.Decompress(c.data)
+			if err != nil {
+				t.Fatalf("lenient Decompress: %v", err)
+			}
+			got, tr, err := huff.DecompressTrailer(nil, c.data)
+			if err != nil {
+				t.Fatalf("lenient DecompressTrailer: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("DecompressTrailer = %x, want %x", got, want)
+			}
+			if tr != c.want {
+				t.Fatalf("trailer = %+v, want %+v", tr, c.want)
+			}
+
+			huff.Strict = true
+			_, err = huff.DecompressTo(nil, c.data)
+			if c.strict && err != nil {
+				t.Fatalf("strict DecompressTo: %v", err)
+			}
+			if !c.strict && !errors.Is(err, ErrTrailingData) {
+				t.Fatalf("strict DecompressTo error = %v, want ErrTrailingData", err)
+			}
+			if !c.strict && !errors.Is(err, ErrHuffmanDecompress) {
+				t.Fatalf("ErrTrailingData must wrap ErrHuffmanDecompress, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReaderTrailer(t *testing.T) {
+	_, cases := trailerCases(t)
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := NewReader(bytes.NewReader(c.data))
+			if _, err := io.ReadAll(r); err != nil {
+				t.Fatalf("lenient read: %v", err)
+			}
+			// outside strict mode only read-ahead bytes are counted, and all
+			// cases are short enough to be read ahead entirely
+			if tr := r.Trailer(); tr != c.want {
+				t.Fatalf("trailer = %+v, want %+v", tr, c.want)
+			}
+
+			r = NewReader(bytes.NewReader(c.data), WithStrict(true))
+			_, err := io.ReadAll(r)
+			if c.strict && err != nil {
+				t.Fatalf("strict read: %v", err)
+			}
+			if !c.strict && !errors.Is(err, ErrTrailingData) {
+				t.Fatalf("strict read error = %v, want ErrTrailingData", err)
+			}
+			wantErr := ErrTrailingData
+			if c.strict {
+				wantErr = io.EOF
+			}
+			if n, err := r.Read(make([]byte, 1)); n != 0 || !errors.Is(err, wantErr) {
+				t.Fatalf("Read after end = (%d, %v), want (0, %v)", n, err, wantErr)
+			}
+		})
+	}
+}
+
+// TestReaderStrictReadsToEnd: trailing data beyond what the Reader reads
+// ahead is only found in strict mode.
+func TestReaderStrictReadsToEnd(t *testing.T) {
+	valid, _ := trailerCases(t)
+	data := append(append([]byte(nil), valid...), make([]byte, 100)...)
+	data = append(data, 1)
+
+	r := NewReader(bytes.NewReader(data))
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatalf("lenient read: %v", err)
+	}
+
+	r = NewReader(bytes.NewReader(data), WithStrict(true))
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrTrailingData) {
+		t.Fatalf("strict read error = %v, want ErrTrailingData", err)
+	}
+	if tr := r.Trailer(); tr.Consumed != int64(len(valid)) || tr.Extra != 101 || tr.ExtraZero {
+		t.Fatalf("trailer = %+v, want %d consumed and 101 non-zero extra bytes", tr, len(valid))
+	}
+}
@@ -0,0 +1,92 @@
+package huffman
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrVarInt is wrapped by the errors of ReadVarInt and the whole-buffer
+	// CompressVarInt and DecompressVarInt.
+	ErrVarInt = errors.New("invalid variable int")
+)
+
+// MaxVarIntLen is the longest encoding of a 32 bit integer by AppendVarInt.
+const MaxVarIntLen = 5
+
+// AppendVarInt appends v to dst the way teeworlds' CVariableInt::Pack does:
+// the first byte holds an extend bit, the sign bit and the low 6 bits, every
+// following byte an extend bit and the next 7 bits. A negative v is stored as
+// its complement with the sign bit set, so small magnitudes of either sign
+// take a single byte.
+func AppendVarInt(dst []byte, v int32) []byte {
+	b := byte(v>>25) & 0x40 // sign bit
+	u := uint32(v ^ v>>31)  // complement if negative
+	b |= byte(u & 0x3f)
+	u >>= 6
+	for u != 0 {
+		dst = append(dst, b|0x80)
+		b = byte(u & 0x7f)
+		u >>= 7
+	}
+	return append(dst, b)
+}
+
+// ReadVarInt decodes an integer written by AppendVarInt from the start of
+// data and returns it along with the number of bytes it took. As in
+// CVariableInt::Unpack, at most MaxVarIntLen bytes are read, of the last only
+// the 4 bits that fit 32 bits are used, and non-minimal encodings are
+// accepted. An encoding running past the end of data is an error.
+func ReadVarInt(data []byte) (int32, int, error) {
+	if len(data) == 0 {
+		return 0, 0, fmt.Errorf("%w: no data", ErrVarInt)
+	}
+	b := data[0]
+	sign := uint32(b>>6) & 1
+	u := uint32(b & 0x3f)
+	n := 1
+	for shift := uint(6); b&0x80 != 0 && n < MaxVarIntLen; shift += 7 {
+		if n == len(data) {
+			return 0, 0, fmt.Errorf("%w: truncated after %d bytes", ErrVarInt, n)
+		}
+		b = data[n]
+		n++
+		if n == MaxVarIntLen {
+			u |= uint32(b&0x0f) << shift
+		} else {
+			u |= uint32(b&0x7f) << shift
+		}
+	}
+	return int32(u ^ -sign), n, nil
+}
+
+// CompressVarInt is the whole-buffer transform of CVariableInt::Compress,
+// which demos and some snapshot code put in front of Huffman compression: it
+// reads src as consecutive little-endian 32 bit integers and appends each one
+// to dst with AppendVarInt. The length of src must be a multiple of 4.
+func CompressVarInt(dst, src []byte) ([]byte, error) {
+	if len(src)%4 != 0 {
+		return dst, fmt.Errorf("%w: input of %d bytes is not a whole number of 32 bit integers", ErrVarInt, len(src))
+	}
+	for i := 0; i < len(src); i += 4 {
+		dst = AppendVarInt(dst, int32(binary.LittleEndian.Uint32(src[i:])))
+	}
+	return dst, nil
+}
+
+// DecompressVarInt reverses CompressVarInt like CVariableInt::Decompress: it
+// decodes src with ReadVarInt until it is used up and appends each integer to
+// dst in little-endian byte order. On error dst is returned unchanged.
+func DecompressVarInt(dst, src []byte) ([]byte, error) {
+	start := len(dst)
+	for pos := 0; pos < len(src); {
+		v, n, err := ReadVarInt(src[pos:])
+		if err != nil {
+			return dst[:start], fmt.Errorf("%w at offset %d", err, pos)
+		}
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(v))
+		pos += n
+	}
+	return dst, nil
+}
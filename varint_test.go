@@ -0,0 +1,168 @@
+package huffman
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+var varIntCases = []struct {
+	v    int32
+	want []byte
+}{
+	{0, []byte{0x00}},
+	{1, []byte{0x01}},
+	{63, []byte{0x3f}},
+	{64, []byte{0x80, 0x01}},
+	{-1, []byte{0x40}},
+	{-64, []byte{0x7f}},
+	{-65, []byte{0xc0, 0x01}},
+	{8191, []byte{0xbf, 0x7f}},
+	{8192, []byte{0x80, 0x80, 0x01}},
+	{math.MaxInt32, []byte{0xbf, 0xff, 0xff, 0xff, 0x0f}},
+	{math.MinInt32, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}},
+}
+
+func TestAppendVarInt(t *testing.T) {
+	for _, test := range varIntCases {
+		got := AppendVarInt([]byte("keep"), test.v)
+		if !bytes.Equal(got[4:], test.want) || string(got[:4]) != "keep" {
+			t.Errorf("AppendVarInt(%d) = %x, want %x", test.v, got[4:], test.want)
+		}
+
+		v, n, err := ReadVarInt(append(test.want, 0xaa))
+		if err != nil || v != test.v || n != len(test.want) {
+			t.Errorf("ReadVarInt(%x) = %d, %d, %v, want %d, %d", test.want, v, n, err, test.v, len(test.want))
+		}
+	}
+}
+
+func TestReadVarIntLenient(t *testing.T) {
+	table := []struct {
+		data []byte
+		want int32
+		n    int
+	}{
+		// non-minimal encodings, as CVariableInt::Unpack takes them
+		{[]byte{0x81, 0x00}, 1, 2},
+		{[]byte{0xc0, 0x80, 0x00}, -1, 3},
+		// the fifth byte ends the integer, extend bit or not
+		{[]byte{0x80, 0x80, 0x80, 0x80, 0xf1, 0x01}, 1 << 27, 5},
+	}
+	for _, test := range table {
+		v, n, err := ReadVarInt(test.data)
+		if err != nil || v != test.want || n != test.n {
+			t.Errorf("ReadVarInt(%x) = %d, %d, %v, want %d, %d", test.data, v, n, err, test.want, test.n)
+		}
+	}
+}
+
+func TestReadVarIntTruncated(t *testing.T) {
+	for _, data := range [][]byte{nil, {0x80}, {0xff, 0xff, 0xff, 0xff}} {
+		if _, _, err := ReadVarInt(data); !errors.Is(err, ErrVarInt) {
+			t.Errorf("ReadVarInt(%x): err = %v, want ErrVarInt", data, err)
+		}
+	}
+}
+
+func TestCompressVarInt(t *testing.T) {
+	var src, want []byte
+	for _, test := range varIntCases {
+		src = binary.LittleEndian.AppendUint32(src, uint32(test.v))
+		want = append(want, test.want...)
+	}
+
+	got, err := CompressVarInt(nil, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("CompressVarInt = %x, want %x", got, want)
+	}
+
+	back, err := DecompressVarInt([]byte("keep"), got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(back, append([]byte("keep"), src...)) {
+		t.Fatalf("DecompressVarInt = %x, want %x", back, src)
+	}
+
+	if _, err := CompressVarInt(nil, src[:5]); !errors.Is(err, ErrVarInt) {
+		t.Fatalf("odd length: err = %v, want ErrVarInt", err)
+	}
+	out, err := DecompressVarInt([]byte("keep"), append(got, 0x80))
+	if !errors.Is(err, ErrVarInt) || string(out) != "keep" {
+		t.Fatalf("truncated: %q, %v, want dst unchanged and ErrVarInt", out, err)
+	}
+}
+
+func FuzzVarInt(f *testing.F) {
+	for _, test := range varIntCases {
+		f.Add(test.v)
+	}
+
+	f.Fuzz(func(t *testing.T, v int32) {
+		data := AppendVarInt(nil, v)
+		if len(data) > MaxVarIntLen {
+			t.Fatalf("%d encoded in %d bytes", v, len(data))
+		}
+		got, n, err := ReadVarInt(data)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got != v || n != len(data) {
+			t.Fatalf("wanted %d in %d bytes, got %d in %d", v, len(data), got, n)
+		}
+	})
+}
+
+func FuzzVarIntCompressDecompress(f *testing.F) {
+	f.Add([]byte("hello world!"))
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x80})
+	f.Add([]byte{0x80, 0x80, 0x80, 0x80, 0xff, 0x01})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// as integers: compressing and decompressing is the identity
+		ints := data[:len(data)&^3]
+		compressed, err := CompressVarInt(nil, ints)
+		if err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
+		}
+		decompressed, err := DecompressVarInt(nil, compressed)
+		if err != nil {
+			t.Fatalf("Unexpected decompression error: %v", err)
+		}
+		if !bytes.Equal(decompressed, ints) {
+			t.Fatalf("wanted %v, got %v", ints, decompressed)
+		}
+
+		// as an encoding: whatever decodes re-encodes to something that
+		// decodes the same, and the whole chain survives Huffman
+		decoded, err := DecompressVarInt(nil, data)
+		if err != nil {
+			return
+		}
+		canonical, err := CompressVarInt(nil, decoded)
+		if err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
+		}
+		packed, err := Compress(canonical)
+		if err != nil {
+			t.Fatalf("Unexpected compression error: %v", err)
+		}
+		unpacked, err := Decompress(packed)
+		if err != nil {
+			t.Fatalf("Unexpected decompression error: %v", err)
+		}
+		again, err := DecompressVarInt(nil, unpacked)
+		if err != nil {
+			t.Fatalf("Unexpected decompression error: %v", err)
+		}
+		if !bytes.Equal(again, decoded) {
+			t.Fatalf("wanted %v, got %v", decoded, again)
+		}
+	})
+}
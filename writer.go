@@ -1,6 +1,8 @@
 package huffman
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -12,26 +14,35 @@ var (
 )
 
 type Writer struct {
-	d   *Dictionary
-	w   io.Writer
-	buf []byte
+	d      *Dictionary
+	w      io.Writer
+	buf    []byte
+	legacy bool
+	limit  int64
+
+	// in is where ReadFrom reads to, kept across calls and Reset.
+	in []byte
 }
 
-// New creates a new Writer that uses the default Teeworlds dictionary in order to compress data.
-func NewWriter(w io.Writer) *Writer {
-	// pass default global dictionary that is used in Teeworlds
-	return NewWriterDict(DefaultDictionary, w)
+// NewWriter creates a new Writer configured by opts, that uses the default
+// Teeworlds dictionary in order to compress data unless WithDictionary is
+// given.
+func NewWriter(w io.Writer, opts ...Option) *Writer {
+	o := newOptions(opts)
+	h := Writer{
+		d:      o.dict,
+		w:      w,
+		buf:    make([]byte, 0, o.bufSize),
+		legacy: o.legacyPadding,
+		limit:  o.outputLimit,
+	}
+	return &h
 }
 
 // NewWriterDict expects a Dictionary (index -> symbol)
 // You can use the default one if you just want to work with Teeworlds' default compression.
 func NewWriterDict(d *Dictionary, w io.Writer) *Writer {
-	h := Writer{
-		d:   d,
-		w:   w,
-		buf: make([]byte, 0, 2048),
-	}
-	return &h
+	return NewWriter(w, WithDictionary(d))
 }
 
 func (w *Writer) flush() error {
@@ -52,6 +63,18 @@ func writeBuffer(w io.Writer, buf []byte) error {
 	return err
 }
 
+// ResetDict is Reset that also replaces the dictionary, e.g. for a pooled
+// Writer serving a connection that negotiated a different one. It checks d
+// first and leaves the Writer unchanged if d cannot be used.
+func (w *Writer) ResetDict(d *Dictionary, rw io.Writer) error {
+	if err := d.usable(ErrHuffmanCompress); err != nil {
+		return err
+	}
+	w.d = d
+	w.Reset(rw)
+	return nil
+}
+
 func (w *Writer) Reset(rw io.Writer) {
 	w.w = rw
 	w.buf = w.buf[:0]
@@ -59,19 +82,32 @@ func (w *Writer) Reset(rw io.Writer) {
 
 // Write compresses the passed data and writes it to the underlying writer.
 // The returned value is the number of uncompressed bytes that were written.
+// A *bytes.Buffer, for streams of up to 32 KiB or the size WithBufferSize
+// sets in the worst case, or a *bufio.Writer large enough for the worst case
+// gets the stream encoded straight into its free space; anything else gets it
+// in pieces staged in a buffer of the size WithBufferSize sets.
 func (w *Writer) Write(data []byte) (written int, err error) {
 	if w == nil {
 		return 0, fmt.Errorf("%w: writer is nil", ErrHuffmanCompress)
 	}
-	if !w.d.isInitialized() {
-		return 0, fmt.Errorf("%w: dictionary is nil or uninitialized", ErrHuffmanCompress)
+	if err := w.d.usable(ErrHuffmanCompress); err != nil {
+		return 0, err
 	}
 	d := w.d
 
-	// Dictionary codes are stored as uint32. Reject deeper custom trees rather
-	// than silently truncating their codes and writing corrupt data.
-	if d.maxCodeLen > maxStoredCodeBits {
-		return 0, fmt.Errorf("%w: dictionary contains %d-bit codes, maximum supported is %d", ErrHuffmanCompress, d.maxCodeLen, maxStoredCodeBits)
+	// The stream is written as it is encoded, so the limit has to be judged
+	// before anything reaches w.
+	if w.limit > 0 {
+		if n := d.encodedLen(data, w.legacy); n > uint64(w.limit) {
+			return 0, fmt.Errorf("%w: %w: stream needs %d bytes, limit is %d", ErrHuffmanCompress, ErrOutputLimit, n, w.limit)
+		}
+	}
+
+	if ok, err := w.writeDirect(data); ok {
+		if err != nil {
+			return 0, err
+		}
+		return len(data), nil
 	}
 
 	var (
@@ -117,7 +153,7 @@ func (w *Writer) Write(data []byte) (written int, err error) {
 		bitCount -= 8
 	}
 	// trailing partial byte, only when bits actually remain (see Compress)
-	if bitCount != 0 {
+	if bitCount != 0 || w.legacy {
 		if len(buf) == cap(buf) {
 			if err = writeBuffer(w.w, buf); err != nil {
 				w.buf = buf[:0]
@@ -135,3 +171,118 @@ func (w *Writer) Write(data []byte) (written int, err error) {
 
 	return len(data), nil
 }
+
+// writeDirect encodes data straight into the free space of a *bytes.Buffer
+// or *bufio.Writer destination, the way Compress encodes into its result,
+// instead of staging it in w.buf and copying it over. It reports whether it
+// could; if not, nothing has been written.
+func (w *Writer) writeDirect(data []byte) (bool, error) {
+	size, ok := compressBufSize(len(data), w.d.maxCodeLen, maxAlloc)
+	if !ok {
+		return false, nil
+	}
+	var (
+		dst   io.Writer
+		avail []byte
+	)
+	switch out := w.w.(type) {
+	case *bytes.Buffer:
+		// Grow reserves the worst case, well above what the stream needs,
+		// so larger writes are staged and let the buffer grow as it fills.
+		if size > uint64(max(cap(w.buf), copyBufSize)) {
+			return false, nil
+		}
+		out.Grow(int(size))
+		dst, avail = out, out.AvailableBuffer()
+	case *bufio.Writer:
+		if uint64(out.Size()) < size {
+			return false, nil
+		}
+		if uint64(out.Available()) < size {
+			if err := out.Flush(); err != nil {
+				return true, err
+			}
+		}
+		dst, avail = out, out.AvailableBuffer()
+	default:
+		return false, nil
+	}
+	// AvailableBuffer is the destination's own storage, so the Write
+	// below copies the encoded bytes onto themselves, if at all.
+	n, _ := w.d.encode(avail[:size], data, w.legacy, noLimit)
+	return true, writeBuffer(dst, avail[:n])
+}
+
+// ReadFrom implements io.ReaderFrom: it compresses everything read from src
+// until io.EOF into a single stream, the same one Write would produce for the
+// whole input, without holding that input in memory. io.Copy uses it, so
+// copying into a Writer yields one stream rather than one per chunk. When src
+// implements io.WriterTo, its data is encoded in place without being copied.
+//
+// The output limit is judged as the stream grows. On any error, the part of
+// the stream already written to the underlying writer lacks its EOF symbol.
+// ReadFrom returns the number of bytes read from src.
+func (w *Writer) ReadFrom(src io.Reader) (read int64, err error) {
+	if w == nil {
+		return 0, fmt.Errorf("%w: writer is nil", ErrHuffmanCompress)
+	}
+	sw := StreamWriter{
+		d:      w.d,
+		w:      w.w,
+		buf:    w.buf[:0],
+		legacy: w.legacy,
+		limit:  w.limit,
+	}
+	defer func() { w.buf = sw.buf[:0] }()
+
+	if wt, ok := src.(io.WriterTo); ok {
+		if read, err = wt.WriteTo(&sw); err != nil {
+			return read, err
+		}
+		return read, sw.Close()
+	}
+
+	if w.in == nil {
+		w.in = make([]byte, copyBufSize)
+	}
+	for {
+		n, rerr := src.Read(w.in)
+		if n > 0 {
+			if _, err = sw.Write(w.in[:n]); err != nil {
+				return read, err
+			}
+			read += int64(n)
+		}
+		if rerr == io.EOF {
+			return read, sw.Close()
+		}
+		if rerr != nil {
+			return read, rerr
+		}
+	}
+}
+
+// encodedLen is the exact size of the stream for data, EOF symbol included,
+// with or without the teeworlds 0.7 trailing byte.
+func (d *Dictionary) encodedLen(data []byte, legacy bool) uint64 {
+	return streamBytes(d.symbolBits(data)+uint64(d.encLen[EofSymbol]), legacy)
+}
+
+// symbolBits is the number of bits the codes for data take.
+func (d *Dictionary) symbolBits(data []byte) uint64 {
+	var bits uint64
+	for _, symbol := range data {
+		bits += uint64(d.encLen[symbol])
+	}
+	return bits
+}
+
+// streamBytes is the size of a finished stream of the given number of bits,
+// EOF symbol included, with or without the teeworlds 0.7 trailing byte.
+func streamBytes(bits uint64, legacy bool) uint64 {
+	n := bits / 8
+	if bits%8 != 0 || legacy {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,95 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestWriterDirect(t *testing.T) {
+	prefix := []byte("already buffered ")
+	for _, e := range regressionCorpus() {
+		want, err := Compress(e.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := bytes.NewBuffer(append([]byte(nil), prefix...))
+		if _, err := NewWriter(buf).Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), append(append([]byte(nil), prefix...), want...)) {
+			t.Fatalf("%s: bytes.Buffer output differs from Compress", e.name)
+		}
+
+		// smaller than the worst case falls back to staging, larger ones
+		// are encoded into, after a flush if need be
+		for _, size := range []int{16, 4096, 1 << 20} {
+			var out bytes.Buffer
+			bw := bufio.NewWriterSize(&out, size)
+			w := NewWriter(bw)
+			for range 2 {
+				if _, err := w.Write(e.data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := bw.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(out.Bytes(), append(append([]byte(nil), want...), want...)) {
+				t.Fatalf("%s, bufio size %d: output differs from Compress", e.name, size)
+			}
+		}
+	}
+}
+
+func TestWriterDirectOptions(t *testing.T) {
+	// byte-aligned EOF symbol, see TestDDNetCompat
+	in := make([]byte, 64)
+	in[0] = 0x15
+	legacy, err := NewHuffman(WithLegacyPadding(true)).Compress(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := NewWriter(&buf, WithLegacyPadding(true)).Write(in); err != nil || !bytes.Equal(buf.Bytes(), legacy) {
+		t.Fatalf("legacy padding into bytes.Buffer = %x, %v, want %x", buf.Bytes(), err, legacy)
+	}
+
+	buf.Reset()
+	if n, err := NewWriter(&buf, WithOutputLimit(int64(len(legacy)-2))).Write(in); n != 0 || !errors.Is(err, ErrOutputLimit) || buf.Len() != 0 {
+		t.Fatalf("bytes.Buffer over the limit = (%d, %v) with %d bytes written", n, err, buf.Len())
+	}
+
+	bw := bufio.NewWriterSize(shortWriter{}, 64)
+	w := NewWriter(bw)
+	payload := snapshotLike(40, 20)
+	for range 10 {
+		if _, err = w.Write(payload); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("Write needing a failing flush error = %v, want io.ErrShortWrite", err)
+	}
+}
+
+// TestWriterDirectLarge: a write whose worst case exceeds the direct bound is
+// staged, so the bytes.Buffer grows with the stream rather than reserving the
+// worst case up front.
+func TestWriterDirectLarge(t *testing.T) {
+	payload := snapshotLike(41, 1<<20)
+	want, err := Compress(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := NewWriter(&buf).Write(payload); err != nil || !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("large write into bytes.Buffer = %v, output differs: %t", err, !bytes.Equal(buf.Bytes(), want))
+	}
+	if worst, _ := compressBufSize(len(payload), DefaultDictionary.maxCodeLen, maxAlloc); uint64(buf.Cap()) >= worst {
+		t.Fatalf("bytes.Buffer grew to %d bytes, the worst case of %d", buf.Cap(), worst)
+	}
+}
@@ -26,3 +26,23 @@ func ExampleWriter_Write() {
 	// Output:
 	// hello world
 }
+
+func ExampleStreamWriter() {
+	var buf bytes.Buffer
+	w := huffman.NewStreamWriter(&buf)
+
+	// two writes, one stream
+	_, _ = io.WriteString(w, "hello ")
+	_, _ = io.WriteString(w, "world")
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+
+	data, err := huffman.Decompress(buf.Bytes())
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(data))
+	// Output:
+	// hello world
+}